@@ -13,18 +13,28 @@ import (
 	"webtechl0/internal/config"
 	"webtechl0/internal/handler"
 	"webtechl0/internal/kafka"
+	"webtechl0/internal/logging"
+	"webtechl0/internal/metrics"
 	"webtechl0/internal/models"
 	"webtechl0/internal/postgres"
 	"webtechl0/internal/repository"
 	"webtechl0/internal/service"
+	"webtechl0/internal/tracing"
 )
 
 const defaultConfigPath = ""
 
+type orderCache interface {
+	service.OrderCache
+	service.CacheSnapshot
+	Stats() cache.Stats
+	Close()
+}
+
 func main() {
-	lg := slog.New(
+	lg := slog.New(logging.NewContextHandler(
 		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-	)
+	))
 
 	cfg, err := config.New(defaultConfigPath)
 	if err != nil {
@@ -35,6 +45,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	tracerProvider, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		lg.Error("Failed to set up tracing", slog.Any("error", err))
+		os.Exit(1)
+	}
+
 	pool, err := postgres.New(ctx, cfg.Database)
 	if err != nil {
 		lg.Error("Failed to connect to postgres", slog.Any("error", err))
@@ -43,23 +59,99 @@ func main() {
 	defer pool.Close()
 
 	orderRepository := repository.NewOrderRepository(pool)
-	orderCache := cache.NewLRUCache[string, *models.Order](cfg.CacheCapacity)
-	orderService := service.NewOrderService(orderRepository, orderCache, lg)
+	var diskCache *cache.DiskCache[*models.Order]
+	if cfg.CacheDiskPath != "" {
+		diskCache, err = cache.OpenDiskCache[*models.Order](cfg.CacheDiskPath, cfg.CacheDiskMaxBytes)
+		if err != nil {
+			lg.Error("Failed to open disk cache", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer func() {
+			if err := diskCache.Close(); err != nil {
+				lg.Error("Failed to close disk cache", slog.Any("error", err))
+			}
+		}()
+		metrics.RegisterCache("orders_disk", diskCache.Stats)
+	}
+
+	orderCache, err := newOrderCache(cfg, diskCache)
+	if err != nil {
+		lg.Error("Failed to create cache", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer orderCache.Close()
+	metrics.RegisterCache("orders", orderCache.Stats)
 
-	orderService.FillCache(ctx)
+	serviceOpts := []service.Option{
+		service.WithWriteThrough(cfg.CacheWriteThrough),
+		service.WithWarmupLimit(cfg.CacheCapacity),
+	}
+	if cfg.NegativeCacheCapacity > 0 {
+		negativeCache := cache.NewLRUCache(cfg.NegativeCacheCapacity,
+			cache.WithTTL[string, struct{}](cfg.NegativeCacheTTL),
+			cache.WithJanitor[string, struct{}](cfg.NegativeCacheTTL),
+		)
+		defer negativeCache.Close()
+		metrics.RegisterCache("orders_negative", negativeCache.Stats)
+		serviceOpts = append(serviceOpts, service.WithNegativeCache(negativeCache))
+	}
+	if cfg.CacheSnapshotPath != "" {
+		serviceOpts = append(serviceOpts, service.WithSnapshot(orderCache, cfg.CacheSnapshotPath, cfg.CacheSnapshotMaxAge))
+	}
+
+	orderService := service.NewOrderService(orderRepository, orderCache, lg, serviceOpts...)
+
+	go func() {
+		if err := orderService.WarmUp(ctx); err != nil {
+			lg.Error("Failed to warm up cache", slog.Any("error", err))
+		}
+	}()
+
+	var deadLetter kafka.DeadLetterPublisher
+	if cfg.Kafka.DeadLetterTopic != "" {
+		deadLetterWriter := kafka.NewDeadLetterWriter(cfg.Kafka.Brokers, cfg.Kafka.DeadLetterTopic)
+		defer deadLetterWriter.Close()
+		deadLetter = deadLetterWriter
+	}
 
-	orderHandler := handler.NewOrderHandler(orderService, lg)
+	consumerHandler := kafka.NewOrderHandler(orderService, deadLetter, lg)
+	consumer := kafka.NewConsumer(cfg.Kafka, consumerHandler, lg)
 
-	router := handler.NewRouter(orderHandler, lg)
+	var idempotencyStore handler.IdempotencyStore
+	if cfg.HTTP.IdempotencyKeyCapacity > 0 {
+		idempotencyCache := cache.NewLRUCache(cfg.HTTP.IdempotencyKeyCapacity,
+			cache.WithTTL[string, handler.IdempotentResponse](cfg.HTTP.IdempotencyKeyTTL),
+			cache.WithJanitor[string, handler.IdempotentResponse](cfg.HTTP.IdempotencyKeyTTL),
+			cache.WithMaxWeight(cfg.HTTP.IdempotencyMaxBytes, handler.IdempotentResponseWeigher),
+		)
+		defer idempotencyCache.Close()
+		metrics.RegisterCache("idempotency_keys", idempotencyCache.Stats)
+		idempotencyStore = idempotencyCache
+	}
+
+	orderHandler := handler.NewOrderHandler(orderService, idempotencyStore, lg)
+	healthHandler := handler.NewHealthHandler([]handler.HealthCheck{
+		{Name: "postgres", Check: func(ctx context.Context) (any, error) {
+			return nil, pool.Ping(ctx)
+		}},
+		{Name: "kafka", Check: func(ctx context.Context) (any, error) {
+			return consumer.Health(ctx)
+		}},
+		handler.WarmupCheck(orderService),
+	}, lg)
+
+	var adminHandler *handler.AdminHandler
+	if cfg.HTTP.AdminToken != "" {
+		adminHandler = handler.NewAdminHandler(ctx, orderService, cfg.HTTP.AdminToken, lg)
+	}
+
+	router := handler.NewRouter(orderHandler, healthHandler, adminHandler, lg)
 	addr := cfg.HTTP.Host + ":" + cfg.HTTP.Port
 	server := http.Server{
 		Addr:    addr,
 		Handler: router,
 	}
 
-	consumerHandler := kafka.NewOrderHandler(orderService, lg)
-	consumer := kafka.NewConsumer(cfg.Kafka, consumerHandler, lg)
-
 	errChan := make(chan error, 1)
 	lg.Info("Starting kafka consumer")
 	go func() {
@@ -75,19 +167,81 @@ func main() {
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+
+	// Start returns before ctx is cancelled only on an unexpected failure. The service then
+	// keeps serving orders from the cache and the DB, reported not ready, until it is stopped.
+	var consumerErr error
+	consumerStopped := false
+	select {
+	case <-sigChan:
+	case consumerErr = <-errChan:
+		consumerStopped = true
+		lg.Error("Kafka consumer stopped, no longer consuming orders", slog.Any("error", consumerErr))
+		<-sigChan
+	}
 
 	lg.Info("Shutdown signal received")
+	healthHandler.Shutdown()
+	if cfg.HTTP.ShutdownDelay > 0 {
+		lg.Info("Draining traffic", slog.Duration("delay", cfg.HTTP.ShutdownDelay))
+		time.Sleep(cfg.HTTP.ShutdownDelay)
+	}
 	cancel()
+	if !consumerStopped {
+		consumerErr = <-errChan
+	}
+
+	// The consumer has stopped, so the cache no longer changes except for lookups.
+	if err := orderService.SaveSnapshot(); err != nil {
+		lg.Error("Failed to save cache snapshot", slog.Any("error", err))
+	}
 
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctxShutdown); err != nil {
 		lg.Error("Failed to shutdown http server", slog.Any("error", err))
 	}
+	if err := tracerProvider.Shutdown(ctxShutdown); err != nil {
+		lg.Error("Failed to flush traces", slog.Any("error", err))
+	}
 
-	if err := <-errChan; err != nil && err != context.Canceled {
-		lg.Error("Kafka consumer failed", slog.Any("error", err))
+	if !consumerStopped && consumerErr != nil && consumerErr != context.Canceled {
+		lg.Error("Kafka consumer failed", slog.Any("error", consumerErr))
 	}
 
 }
+
+// newOrderCache creates the in-memory cache and, when diskCache is not nil, puts it in front
+// of the disk cache.
+func newOrderCache(cfg *config.Config, diskCache *cache.DiskCache[*models.Order]) (orderCache, error) {
+	opts := []cache.Option[string, *models.Order]{
+		cache.WithTTL[string, *models.Order](cfg.CacheTTL),
+		cache.WithOnEvict(func(_ string, _ *models.Order, reason cache.EvictionReason) {
+			metrics.CacheRemovals.WithLabelValues("orders", reason.String()).Inc()
+		}),
+	}
+	if cfg.CacheTTL > 0 {
+		opts = append(opts, cache.WithJanitor[string, *models.Order](cfg.CacheJanitorInterval))
+	}
+	if cfg.CacheMaxBytes > 0 {
+		opts = append(opts, cache.WithMaxWeight(cfg.CacheMaxBytes, service.OrderWeigher))
+	}
+	if diskCache != nil {
+		opts = append(opts, cache.SpillTo[string, *models.Order](diskCache))
+	}
+
+	policy := cache.Policy(cfg.CachePolicy)
+	if cfg.CacheShards > 1 {
+		memory, err := cache.NewShardedCache(policy, cfg.CacheCapacity, cfg.CacheShards, opts...)
+		if err != nil || diskCache == nil {
+			return memory, err
+		}
+		return cache.NewTieredCache(memory, diskCache), nil
+	}
+
+	memory, err := cache.New(policy, cfg.CacheCapacity, opts...)
+	if err != nil || diskCache == nil {
+		return memory, err
+	}
+	return cache.NewTieredCache(memory, diskCache), nil
+}
@@ -0,0 +1,131 @@
+package cache_test
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"webtechl0/internal/cache"
+)
+
+const (
+	benchCapacity = 10_000
+	benchKeys     = 20_000
+)
+
+type benchCache interface {
+	Get(key string) (int, bool)
+	Put(key string, value int)
+}
+
+func benchKeySet() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "order-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// benchmarkParallel runs a read-heavy workload, nine reads for every write, from all procs.
+func benchmarkParallel(b *testing.B, c benchCache) {
+	keys := benchKeySet()
+	for i, key := range keys[:benchCapacity] {
+		c.Put(key, i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		for pb.Next() {
+			i := r.IntN(len(keys))
+			if i%10 == 0 {
+				c.Put(keys[i], i)
+			} else {
+				c.Get(keys[i])
+			}
+		}
+	})
+}
+
+func BenchmarkLRUCacheParallel(b *testing.B) {
+	benchmarkParallel(b, cache.NewLRUCache[string, int](benchCapacity))
+}
+
+func BenchmarkShardedLRUCacheParallel(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(strconv.Itoa(shards)+"_shards", func(b *testing.B) {
+			benchmarkParallel(b, cache.NewShardedLRUCache[string, int](benchCapacity, shards))
+		})
+	}
+}
+
+const (
+	zipfCapacity = 1_000
+	zipfKeys     = 100_000
+	zipfWarmup   = 50_000
+	zipfLookups  = 500_000
+)
+
+// zipfTrace returns the keys of a Zipf distribution over zipfKeys keys, the same on every
+// call. With scan set, every other key is one that is never requested again, as in a large
+// scan of one-off lookups.
+func zipfTrace(skew float64, scan bool) []uint64 {
+	r := rand.New(rand.NewPCG(1, 2))
+	zipf := rand.NewZipf(r, skew, 1, zipfKeys-1)
+	next := uint64(zipfKeys)
+
+	trace := make([]uint64, zipfWarmup+zipfLookups)
+	for i := range trace {
+		trace[i] = zipf.Uint64()
+		if scan && i%2 == 1 {
+			trace[i] = next
+			next++
+		}
+	}
+	return trace
+}
+
+// benchmarkHitRatio replays the trace on an empty cache, adding keys on misses, and reports
+// the share of hits after the first zipfWarmup lookups. Every iteration replays the whole
+// trace, so the ratio does not depend on b.N.
+func benchmarkHitRatio(b *testing.B, policy cache.Policy, trace []uint64) {
+	var hits int
+	for range b.N {
+		c, err := cache.New[uint64, uint64](policy, zipfCapacity)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		hits = 0
+		for i, key := range trace {
+			if _, ok := c.Get(key); ok {
+				if i >= zipfWarmup {
+					hits++
+				}
+				continue
+			}
+			c.Put(key, key)
+		}
+	}
+
+	b.ReportMetric(float64(hits)/float64(len(trace)-zipfWarmup), "hit-ratio")
+}
+
+func BenchmarkHitRatio(b *testing.B) {
+	for _, workload := range []struct {
+		name string
+		skew float64
+		scan bool
+	}{
+		{"zipf_1.01", 1.01, false},
+		{"zipf_1.2", 1.2, false},
+		{"zipf_1.01_scan", 1.01, true},
+	} {
+		trace := zipfTrace(workload.skew, workload.scan)
+		for _, policy := range []cache.Policy{cache.PolicyLRU, cache.PolicyLFU, cache.PolicyTinyLFU} {
+			b.Run(workload.name+"/"+string(policy), func(b *testing.B) {
+				benchmarkHitRatio(b, policy, trace)
+			})
+		}
+	}
+}
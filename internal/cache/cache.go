@@ -1,59 +1,472 @@
 package cache
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
 
 type CacheEntry[K comparable, V any] struct {
-	key   K
-	value V
+	key        K
+	value      V
+	expiresAt  time.Time
+	accessedAt time.Time
+	weight     int64
 }
 
-type LRUCache[K comparable, V any] struct {
+func (e *CacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Cache is a fixed capacity cache with optional expiration and weight limit. Which entry is
+// evicted when the cache is full is decided by its eviction policy, see NewLRUCache,
+// NewLFUCache and NewTinyLFUCache. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
 	capacity int
-	data     map[K]*Node[CacheEntry[K, V]]
-	list     *DoubleLinkedList[CacheEntry[K, V]]
+	ttl      time.Duration
+	policy   policy[K, V]
 	mutex    sync.Mutex
+
+	weigher   Weigher[K, V]
+	weight    int64
+	maxWeight int64
+	evictFn   func(entry *CacheEntry[K, V])
+
+	// onEvict callbacks are run for the removals collected in pending once the mutex is released.
+	onEvict []EvictFunc[K, V]
+	pending []removal[K, V]
+	// lower receives the entries evicted for lack of capacity, see SpillTo.
+	lower Tier[K, V]
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+
+	janitorInterval time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+// LRUCache is the name the cache had when LRU was its only policy, kept so that code using
+// it keeps compiling.
+type LRUCache[K comparable, V any] = Cache[K, V]
+
+// policy keeps the entries of a cache and decides which of them to evict. It is not safe
+// for concurrent use, the cache serialises access to it.
+type policy[K comparable, V any] interface {
+	// get returns the entry and records the access.
+	get(key K) (*CacheEntry[K, V], bool)
+	// add inserts a new entry and passes the entries it evicts to make room for it to evict.
+	// A policy with admission may reject the new entry itself, that counts as an eviction.
+	add(entry CacheEntry[K, V], evict func(entry *CacheEntry[K, V]))
+	remove(key K) (CacheEntry[K, V], bool)
+	clear()
+	// evictOne removes the first candidate for eviction, it is used to keep the total weight
+	// under the limit.
+	evictOne() (CacheEntry[K, V], bool)
+	len() int
+	// walk calls fn for the entries from the first to the last candidate for eviction.
+	walk(fn func(entry *CacheEntry[K, V]))
+}
+
+type Option[K comparable, V any] func(*Cache[K, V])
+
+// WithTTL sets the default time to live of entries added with Put.
+// Zero means entries never expire.
+func WithTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.ttl = ttl
+	}
+}
+
+// WithJanitor starts a background goroutine that removes expired entries every interval.
+// The goroutine runs until Close is called.
+func WithJanitor[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.janitorInterval = interval
+	}
+}
+
+// EvictionReason tells why an entry left the cache.
+type EvictionReason int
+
+const (
+	// EvictionCapacity means the entry was evicted to stay within the capacity or the weight
+	// limit, or rejected by the admission policy.
+	EvictionCapacity EvictionReason = iota
+	EvictionExpired
+	// EvictionDeleted means the entry was removed by Delete or Clear.
+	EvictionDeleted
+	// EvictionReplaced means Put replaced the value, the callback gets the old one.
+	EvictionReplaced
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionExpired:
+		return "expired"
+	case EvictionDeleted:
+		return "deleted"
+	case EvictionReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+type EvictFunc[K comparable, V any] func(key K, value V, reason EvictionReason)
+
+type removal[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+	// expiresAt and evictedAt are only set for entries spilled to the lower tier.
+	expiresAt time.Time
+	evictedAt time.Time
+}
+
+// WithOnEvict adds a callback run for every entry that leaves the cache. Callbacks run after
+// the cache mutex is released, in the goroutine whose call removed the entry, so they may
+// call the cache but delay that call until they return.
+func WithOnEvict[K comparable, V any](fn EvictFunc[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = append(c.onEvict, fn)
+	}
+}
+
+// Weigher returns the weight of an entry, usually its approximate size in bytes.
+type Weigher[K comparable, V any] func(key K, value V) int64
+
+// WithMaxWeight bounds the total weight of the entries as computed by weigher. Entries are
+// evicted in the order of the eviction policy until the total fits, an entry heavier than
+// maxWeight is not cached at all. The capacity still limits the number of entries.
+func WithMaxWeight[K comparable, V any](maxWeight int64, weigher Weigher[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.maxWeight = maxWeight
+		c.weigher = weigher
+	}
+}
+
+// Policy names an eviction policy.
+type Policy string
+
+const (
+	PolicyLRU     Policy = "lru"
+	PolicyLFU     Policy = "lfu"
+	PolicyTinyLFU Policy = "tinylfu"
+)
+
+var ErrUnknownPolicy = errors.New("unknown eviction policy")
+
+// New returns a cache with the given eviction policy.
+func New[K comparable, V any](policy Policy, capacity int, opts ...Option[K, V]) (*Cache[K, V], error) {
+	switch policy {
+	case PolicyLRU:
+		return NewLRUCache(capacity, opts...), nil
+	case PolicyLFU:
+		return NewLFUCache(capacity, opts...), nil
+	case PolicyTinyLFU:
+		return NewTinyLFUCache(capacity, opts...), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPolicy, policy)
+	}
 }
 
-func NewLRUCache[K comparable, V any](capacity int) *LRUCache[K, V] {
-	return &LRUCache[K, V]{
+func newCache[K comparable, V any](capacity int, policy policy[K, V], opts ...Option[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{
 		capacity: capacity,
-		data:     make(map[K]*Node[CacheEntry[K, V]]),
-		list:     NewDoubleLinkedList[CacheEntry[K, V]](),
+		policy:   policy,
+		stop:     make(chan struct{}),
 	}
+
+	c.evictFn = c.evicted
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.janitorInterval > 0 {
+		go c.janitor(c.janitorInterval)
+	}
+
+	return c
+}
+
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Size        int
+	Capacity    int
+	// Weight and MaxWeight are zero unless the cache was created WithMaxWeight.
+	Weight    int64
+	MaxWeight int64
+	// Errors counts failed reads and writes of a DiskCache.
+	Errors uint64
 }
 
-func (c *LRUCache[K, V]) Get(key K) (V, bool) {
+func (c *Cache[K, V]) Get(key K) (V, bool) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
+
+	if entry, ok := c.policy.get(key); ok {
+		now := time.Now()
+		if entry.expired(now) {
+			c.removeEntry(key, EvictionExpired)
+			c.expirations++
+			c.misses++
+			var v V
+			return v, false
+		}
 
-	if node, ok := c.data[key]; ok {
-		c.list.MoveToFront(node)
-		return node.data.value, true
+		entry.accessedAt = now
+		c.hits++
+		return entry.value, true
 	}
 
+	c.misses++
 	var v V
 	return v, false
 }
 
-func (c *LRUCache[K, V]) Put(key K, value V) {
+// Put adds the value with the default TTL of the cache.
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.PutWithTTL(key, value, c.ttl)
+}
+
+// PutWithTTL adds the value that expires after ttl. Zero ttl means the value never expires.
+func (c *Cache[K, V]) PutWithTTL(key K, value V, ttl time.Duration) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
 
 	if c.capacity == 0 {
 		return
 	}
 
-	if node, ok := c.data[key]; ok {
-		node.data.value = value
-		c.list.MoveToFront(node)
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	c.put(key, value, expiresAt)
+}
+
+func (c *Cache[K, V]) put(key K, value V, expiresAt time.Time) {
+	var weight int64
+	if c.maxWeight > 0 {
+		weight = c.weigher(key, value)
+		if weight > c.maxWeight {
+			c.removeEntry(key, EvictionReplaced)
+			return
+		}
+	}
+
+	now := time.Now()
+	if entry, ok := c.policy.get(key); ok {
+		c.record(entry, EvictionReplaced)
+		c.weight += weight - entry.weight
+		entry.value = value
+		entry.expiresAt = expiresAt
+		entry.accessedAt = now
+		entry.weight = weight
 	} else {
-		node := NewNode(CacheEntry[K, V]{key: key, value: value})
-		c.list.PushFront(node)
-		c.data[key] = node
+		c.weight += weight
+		c.policy.add(CacheEntry[K, V]{key: key, value: value, expiresAt: expiresAt, accessedAt: now, weight: weight}, c.evictFn)
+	}
+
+	for c.maxWeight > 0 && c.weight > c.maxWeight {
+		entry, ok := c.policy.evictOne()
+		if !ok {
+			break
+		}
+		c.evicted(&entry)
+	}
+}
+
+func (c *Cache[K, V]) evicted(entry *CacheEntry[K, V]) {
+	c.weight -= entry.weight
+	c.evictions++
+	c.record(entry, EvictionCapacity)
+}
+
+func (c *Cache[K, V]) removeEntry(key K, reason EvictionReason) bool {
+	entry, ok := c.policy.remove(key)
+	if ok {
+		c.weight -= entry.weight
+		c.record(&entry, reason)
+	}
+	return ok
+}
+
+func (c *Cache[K, V]) record(entry *CacheEntry[K, V], reason EvictionReason) {
+	r := removal[K, V]{key: entry.key, value: entry.value, reason: reason}
+	if c.lower != nil && reason == EvictionCapacity {
+		r.expiresAt, r.evictedAt = entry.expiresAt, time.Now()
+	} else if len(c.onEvict) == 0 {
+		return
+	}
+	c.pending = append(c.pending, r)
+}
+
+// unlock releases the mutex and then runs the callbacks for the entries removed while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+
+	for _, r := range pending {
+		if !r.evictedAt.IsZero() && (r.expiresAt.IsZero() || r.evictedAt.Before(r.expiresAt)) {
+			c.lower.Spill(r.key, r.value, r.expiresAt, r.evictedAt)
+		}
+		for _, fn := range c.onEvict {
+			fn(r.key, r.value, r.reason)
+		}
+	}
+}
+
+// Delete removes the key from the cache and reports whether it was present.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	return c.removeEntry(key, EvictionDeleted)
+}
+
+// Len returns the number of entries, including expired entries not removed yet.
+func (c *Cache[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.policy.len()
+}
+
+// Clear removes all entries and returns how many there were. Removed entries are not
+// counted as evictions.
+func (c *Cache[K, V]) Clear() int {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	n := c.policy.len()
+	if len(c.onEvict) > 0 {
+		c.policy.walk(func(entry *CacheEntry[K, V]) {
+			c.record(entry, EvictionDeleted)
+		})
+	}
+	c.policy.clear()
+	c.weight = 0
+	return n
+}
+
+// EntryInfo describes a cached entry without its value.
+type EntryInfo[K comparable] struct {
+	Key        K
+	AccessedAt time.Time
+	// ExpiresAt is zero for entries that never expire.
+	ExpiresAt time.Time
+}
+
+// Range calls fn for the live entries from the last to the first candidate for eviction,
+// for LRU from the most recently used, until fn returns false. It iterates over a copy of
+// the entries taken at the start, so fn may call the cache.
+func (c *Cache[K, V]) Range(fn func(key K, value V) bool) {
+	for _, entry := range c.liveEntries() {
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// Keys returns the keys of the live entries in the order of Range.
+func (c *Cache[K, V]) Keys() []K {
+	entries := c.liveEntries()
+	keys := make([]K, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.key
+	}
+	return keys
+}
+
+// Entries returns the live entries in the order of Range.
+func (c *Cache[K, V]) Entries() []EntryInfo[K] {
+	entries := c.liveEntries()
+	infos := make([]EntryInfo[K], len(entries))
+	for i, entry := range entries {
+		infos[i] = EntryInfo[K]{Key: entry.key, AccessedAt: entry.accessedAt, ExpiresAt: entry.expiresAt}
 	}
+	return infos
+}
+
+func (c *Cache[K, V]) liveEntries() []CacheEntry[K, V] {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	entries := make([]CacheEntry[K, V], 0, c.policy.len())
+	c.policy.walk(func(entry *CacheEntry[K, V]) {
+		if !entry.expired(now) {
+			entries = append(entries, *entry)
+		}
+	})
+	slices.Reverse(entries)
+	return entries
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+		Size:        c.policy.len(),
+		Capacity:    c.capacity,
+		Weight:      c.weight,
+		MaxWeight:   c.maxWeight,
+	}
+}
+
+// Close stops the janitor. The cache remains usable, expired entries are still removed on Get.
+func (c *Cache[K, V]) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func (c *Cache[K, V]) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cache[K, V]) removeExpired() {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	now := time.Now()
+	var expired []K
+	c.policy.walk(func(entry *CacheEntry[K, V]) {
+		if entry.expired(now) {
+			expired = append(expired, entry.key)
+		}
+	})
 
-	if c.list.Size() > c.capacity {
-		node := c.list.PopBack()
-		delete(c.data, node.data.key)
+	for _, key := range expired {
+		c.removeEntry(key, EvictionExpired)
+		c.expirations++
 	}
 }
@@ -1,10 +1,15 @@
 package cache_test
 
 import (
+	"slices"
 	"testing"
+	"time"
 	"webtechl0/internal/cache"
 )
 
+// LRUCache stays an alias of Cache, which NewLRUCache returns.
+var _ *cache.LRUCache[int, int] = cache.NewLRUCache[int, int](2)
+
 func TestLRUCache(t *testing.T) {
 	c := cache.NewLRUCache[int, int](2)
 	c.Put(1, 1)
@@ -42,3 +47,193 @@ func TestLRUCache(t *testing.T) {
 		t.Errorf("expected key 1 to be evicted")
 	}
 }
+
+func TestLRUCacheTTL(t *testing.T) {
+	c := cache.NewLRUCache(10, cache.WithTTL[int, int](20*time.Millisecond))
+	defer c.Close()
+
+	c.Put(1, 1)
+	c.PutWithTTL(2, 2, time.Hour)
+	c.PutWithTTL(3, 3, 0)
+
+	if val, ok := c.Get(1); !ok || val != 1 {
+		t.Errorf("expected key 1 to have value 1 before expiry, got %v", val)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok := c.Get(1); ok {
+		t.Errorf("expected key 1 to be expired")
+	}
+
+	if val, ok := c.Get(2); !ok || val != 2 {
+		t.Errorf("expected key 2 to outlive the default TTL")
+	}
+
+	if val, ok := c.Get(3); !ok || val != 3 {
+		t.Errorf("expected key 3 to never expire")
+	}
+}
+
+func TestLRUCacheJanitor(t *testing.T) {
+	c := cache.NewLRUCache(2,
+		cache.WithTTL[int, int](10*time.Millisecond),
+		cache.WithJanitor[int, int](5*time.Millisecond),
+	)
+	defer c.Close()
+
+	c.PutWithTTL(1, 1, time.Hour)
+	c.Put(2, 2)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Key 1 is the least recently used, it survives only if the janitor has freed the slot of key 2.
+	c.Put(3, 3)
+	if _, ok := c.Get(1); !ok {
+		t.Errorf("expected janitor to remove expired key 2 before key 1 was evicted")
+	}
+}
+
+func TestLRUCacheStats(t *testing.T) {
+	c := cache.NewLRUCache[int, int](2)
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.Get(1)
+	c.Get(3)
+	c.Put(3, 3)
+
+	expected := cache.Stats{Hits: 1, Misses: 1, Evictions: 1, Size: 2, Capacity: 2}
+	if s := c.Stats(); s != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, s)
+	}
+}
+
+func TestShardedLRUCache(t *testing.T) {
+	c := cache.NewShardedLRUCache[int, int](800, 8)
+	for i := range 100 {
+		c.Put(i, i*10)
+	}
+
+	for i := range 100 {
+		if val, ok := c.Get(i); !ok || val != i*10 {
+			t.Errorf("expected key %d to have value %d, got %v", i, i*10, val)
+		}
+	}
+
+	for i := 100; i < 10000; i++ {
+		c.Put(i, i)
+	}
+
+	if s := c.Stats(); s.Size != 800 || s.Capacity != 800 {
+		t.Errorf("expected size and capacity 800, got %+v", s)
+	}
+}
+
+func TestCacheMaxWeight(t *testing.T) {
+	weigher := func(key string, value int) int64 { return int64(value) }
+	for _, policy := range []cache.Policy{cache.PolicyLRU, cache.PolicyLFU, cache.PolicyTinyLFU} {
+		c, err := cache.New(policy, 100, cache.WithMaxWeight(10, weigher))
+		if err != nil {
+			t.Fatalf("failed to create %s cache: %v", policy, err)
+		}
+
+		c.Put("a", 4)
+		c.Put("b", 4)
+		c.Put("c", 4)
+		if s := c.Stats(); s.Weight > 10 || s.Size != 2 || s.Evictions != 1 {
+			t.Errorf("%s: expected 2 entries within weight 10, got %+v", policy, s)
+		}
+
+		c.Put("huge", 11)
+		if _, ok := c.Get("huge"); ok {
+			t.Errorf("%s: expected entry heavier than the limit not to be cached", policy)
+		}
+
+		c.Put("c", 1)
+		c.Delete("c")
+		s := c.Stats()
+		if s.Size == 0 || s.Weight != int64(4*s.Size) {
+			t.Errorf("%s: expected weight to follow updates and deletes, got %+v", policy, s)
+		}
+	}
+}
+
+func TestCacheInspection(t *testing.T) {
+	c := cache.NewLRUCache[int, int](3)
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.Put(3, 3)
+	c.Get(1)
+
+	if keys := c.Keys(); !slices.Equal(keys, []int{1, 3, 2}) {
+		t.Errorf("expected keys from the most recently used, got %v", keys)
+	}
+
+	var ranged []int
+	c.Range(func(key, value int) bool {
+		ranged = append(ranged, key)
+		return len(ranged) < 2
+	})
+	if !slices.Equal(ranged, []int{1, 3}) {
+		t.Errorf("expected Range to stop after 2 keys, got %v", ranged)
+	}
+
+	entries := c.Entries()
+	if len(entries) != 3 || entries[0].Key != 1 || entries[0].AccessedAt.Before(entries[1].AccessedAt) {
+		t.Errorf("expected entries with access times, got %+v", entries)
+	}
+
+	if n := c.Clear(); n != 3 || c.Len() != 0 {
+		t.Errorf("expected 3 entries cleared and none left, got %d and %d", n, c.Len())
+	}
+	if s := c.Stats(); s.Evictions != 0 {
+		t.Errorf("expected Clear not to count evictions, got %d", s.Evictions)
+	}
+
+	c.Put(4, 4)
+	if val, ok := c.Get(4); !ok || val != 4 || c.Len() != 1 {
+		t.Errorf("expected cache to be usable after Clear")
+	}
+}
+
+func TestCacheOnEvict(t *testing.T) {
+	type event struct {
+		key    int
+		value  int
+		reason cache.EvictionReason
+	}
+	var events []event
+
+	var c *cache.Cache[int, int]
+	c = cache.NewLRUCache(2,
+		cache.WithTTL[int, int](time.Hour),
+		cache.WithOnEvict(func(key, value int, reason cache.EvictionReason) {
+			// The mutex is released, so the callback may use the cache.
+			c.Len()
+			events = append(events, event{key, value, reason})
+		}),
+	)
+
+	c.Put(1, 1)
+	c.Put(1, 10)
+	c.Put(2, 2)
+	c.Put(3, 3)
+	c.Delete(2)
+	c.PutWithTTL(4, 4, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	c.Get(4)
+	c.Put(5, 5)
+	c.Clear()
+
+	want := []event{
+		{1, 1, cache.EvictionReplaced},
+		{1, 10, cache.EvictionCapacity},
+		{2, 2, cache.EvictionDeleted},
+		{4, 4, cache.EvictionExpired},
+		{3, 3, cache.EvictionDeleted},
+		{5, 5, cache.EvictionDeleted},
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("expected events %v, got %v", want, events)
+	}
+}
@@ -0,0 +1,351 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	diskDataBucket  = []byte("entries")
+	diskOrderBucket = []byte("order")
+)
+
+// Every record starts with the write sequence number and the expiry time in Unix nanoseconds,
+// zero if the value never expires, followed by the value.
+const (
+	boltMagic = 0xED0CDAED
+
+	diskSeqSize    = 8
+	diskHeaderSize = diskSeqSize + 8
+)
+
+// DiskCache is a cache of gob encoded values in an embedded bbolt database, meant as a second
+// tier behind an in-memory cache. Its total size in bytes is bounded, the entries written
+// first are evicted first. Reads do not reorder entries, so they never write to disk: expired
+// entries are skipped and left for eviction.
+//
+// A database that bbolt reports as corrupted is recreated empty on open, any other file at the
+// path is left alone.
+type DiskCache[V any] struct {
+	db       *bolt.DB
+	maxBytes int64
+
+	// writeMutex keeps size and count in step with the committed database.
+	writeMutex sync.Mutex
+	size       atomic.Int64
+	count      atomic.Int64
+	// deletedAt is the time of the last Delete or Clear, spills of values evicted before it
+	// are dropped. It is guarded by writeMutex.
+	deletedAt time.Time
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	errors      atomic.Uint64
+}
+
+// OpenDiskCache opens or creates the database at path, bounded to maxBytes of keys and values.
+func OpenDiskCache[V any](path string, maxBytes int64) (*DiskCache[V], error) {
+	opts := &bolt.Options{Timeout: time.Second, NoFreelistSync: true}
+
+	db, err := bolt.Open(path, 0o600, opts)
+	if isCorrupted(path, err) {
+		// The contents are only a cache, start over rather than fail.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove broken disk cache: %w", err)
+		}
+		db, err = bolt.Open(path, 0o600, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk cache: %w", err)
+	}
+
+	c := &DiskCache[V]{db: db, maxBytes: maxBytes}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(diskOrderBucket); err != nil {
+			return err
+		}
+		data, err := tx.CreateBucketIfNotExists(diskDataBucket)
+		if err != nil {
+			return err
+		}
+
+		return data.ForEach(func(k, v []byte) error {
+			c.size.Add(int64(len(k) + len(v)))
+			c.count.Add(1)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize disk cache: %w", err)
+	}
+
+	return c, nil
+}
+
+// isCorrupted reports whether err means the file at path is a broken bbolt database. bbolt
+// returns ErrInvalid for any file without its magic number as well, so those are only
+// treated as broken if the first page still carries it.
+func isCorrupted(path string, err error) bool {
+	if errors.Is(err, bolt.ErrChecksum) || errors.Is(err, bolt.ErrVersionMismatch) {
+		return true
+	}
+	if !errors.Is(err, bolt.ErrInvalid) {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// The first page is a 16 byte page header followed by the meta page, which starts with the
+	// magic number in native byte order.
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 16); err != nil {
+		return false
+	}
+	return binary.NativeEndian.Uint32(magic[:]) == boltMagic
+}
+
+func (c *DiskCache[V]) Get(key string) (V, bool) {
+	value, _, ok := c.GetWithExpiry(key)
+	return value, ok
+}
+
+// GetWithExpiry returns the value and when it expires, zero if it never does. Expired values
+// are not returned.
+func (c *DiskCache[V]) GetWithExpiry(key string) (V, time.Time, bool) {
+	var value V
+	var payload []byte
+	var expiresAt time.Time
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if record := tx.Bucket(diskDataBucket).Get([]byte(key)); record != nil {
+			if expires := int64(binary.BigEndian.Uint64(record[diskSeqSize:])); expires != 0 {
+				expiresAt = time.Unix(0, expires)
+			}
+			payload = bytes.Clone(record[diskHeaderSize:])
+		}
+		return nil
+	})
+
+	expired := payload != nil && !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+	if err == nil && payload != nil && !expired {
+		err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&value)
+	}
+
+	switch {
+	case err != nil:
+		c.errors.Add(1)
+		c.misses.Add(1)
+		var zero V
+		return zero, time.Time{}, false
+	case expired:
+		c.expirations.Add(1)
+		c.misses.Add(1)
+		return value, time.Time{}, false
+	case payload == nil:
+		c.misses.Add(1)
+		return value, time.Time{}, false
+	}
+
+	c.hits.Add(1)
+	return value, expiresAt, true
+}
+
+// Put stores the value that never expires, evicting the oldest entries to stay within the
+// size limit. A value that does not fit at all is not stored. Failures are counted in Stats.
+func (c *DiskCache[V]) Put(key string, value V) {
+	c.put(key, value, time.Time{}, time.Time{})
+}
+
+// Spill stores the value like Put, until expiresAt unless it is zero. The value is dropped if
+// it was evicted from memory at or before the last Delete or Clear, as it may be the one
+// that was deleted.
+func (c *DiskCache[V]) Spill(key string, value V, expiresAt, evictedAt time.Time) {
+	c.put(key, value, expiresAt, evictedAt)
+}
+
+func (c *DiskCache[V]) put(key string, value V, expiresAt, evictedAt time.Time) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(value); err != nil {
+		c.errors.Add(1)
+		return
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if !evictedAt.IsZero() && !evictedAt.After(c.deletedAt) {
+		return
+	}
+	if int64(len(key)+diskHeaderSize+payload.Len()) > c.maxBytes {
+		c.delete(key)
+		return
+	}
+
+	size, count := c.size.Load(), c.count.Load()
+	var evicted uint64
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		data, order := tx.Bucket(diskDataBucket), tx.Bucket(diskOrderBucket)
+		k := []byte(key)
+
+		if old := data.Get(k); old != nil {
+			if err := order.Delete(old[:diskSeqSize]); err != nil {
+				return err
+			}
+			size -= int64(len(k) + len(old))
+			count--
+		}
+
+		seq, err := order.NextSequence()
+		if err != nil {
+			return err
+		}
+		record := make([]byte, diskHeaderSize+payload.Len())
+		binary.BigEndian.PutUint64(record, seq)
+		if !expiresAt.IsZero() {
+			binary.BigEndian.PutUint64(record[diskSeqSize:], uint64(expiresAt.UnixNano()))
+		}
+		copy(record[diskHeaderSize:], payload.Bytes())
+
+		if err := data.Put(k, record); err != nil {
+			return err
+		}
+		if err := order.Put(record[:diskSeqSize], k); err != nil {
+			return err
+		}
+		size += int64(len(k) + len(record))
+		count++
+
+		cursor := order.Cursor()
+		for seq, oldest := cursor.First(); seq != nil && size > c.maxBytes; seq, oldest = cursor.First() {
+			size -= int64(len(oldest) + len(data.Get(oldest)))
+			count--
+			evicted++
+			if err := data.Delete(oldest); err != nil {
+				return err
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+
+	c.size.Store(size)
+	c.count.Store(count)
+	c.evictions.Add(evicted)
+}
+
+func (c *DiskCache[V]) Delete(key string) bool {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.deletedAt = time.Now()
+	return c.delete(key)
+}
+
+// delete removes the key, the caller holds writeMutex.
+func (c *DiskCache[V]) delete(key string) bool {
+	deleted := false
+	var freed int64
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		data, order := tx.Bucket(diskDataBucket), tx.Bucket(diskOrderBucket)
+		k := []byte(key)
+
+		old := data.Get(k)
+		if old == nil {
+			return nil
+		}
+		freed = int64(len(k) + len(old))
+		deleted = true
+
+		if err := order.Delete(old[:diskSeqSize]); err != nil {
+			return err
+		}
+		return data.Delete(k)
+	})
+	if err != nil {
+		c.errors.Add(1)
+		return false
+	}
+
+	if deleted {
+		c.size.Add(-freed)
+		c.count.Add(-1)
+	}
+	return deleted
+}
+
+func (c *DiskCache[V]) Len() int {
+	return int(c.count.Load())
+}
+
+// Clear removes all entries and returns how many there were.
+func (c *DiskCache[V]) Clear() int {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.deletedAt = time.Now()
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{diskDataBucket, diskOrderBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.errors.Add(1)
+		return 0
+	}
+
+	c.size.Store(0)
+	return int(c.count.Swap(0))
+}
+
+// Stats reports the size in bytes as Weight and the size limit as MaxWeight.
+func (c *DiskCache[V]) Stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+		Errors:      c.errors.Load(),
+		Size:        int(c.count.Load()),
+		Weight:      c.size.Load(),
+		MaxWeight:   c.maxBytes,
+	}
+}
+
+// Close flushes the database to disk and closes it.
+func (c *DiskCache[V]) Close() error {
+	if err := c.db.Sync(); err != nil {
+		c.db.Close()
+		return fmt.Errorf("failed to sync disk cache: %w", err)
+	}
+	return c.db.Close()
+}
@@ -0,0 +1,292 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"webtechl0/internal/cache"
+)
+
+type diskValue struct {
+	Name  string
+	Items []int
+}
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	c, err := cache.OpenDiskCache[diskValue](path, 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+
+	c.Put("a", diskValue{Name: "a", Items: []int{1, 2}})
+	c.Put("b", diskValue{Name: "b"})
+	c.Put("b", diskValue{Name: "b2"})
+
+	if val, ok := c.Get("a"); !ok || val.Name != "a" || len(val.Items) != 2 {
+		t.Errorf("expected value a, got %+v", val)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Errorf("expected missing key not to be found")
+	}
+	if !c.Delete("a") || c.Delete("a") {
+		t.Errorf("expected key a to be deleted once")
+	}
+
+	size := c.Stats().Weight
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close disk cache: %v", err)
+	}
+
+	c, err = cache.OpenDiskCache[diskValue](path, 1<<20)
+	if err != nil {
+		t.Fatalf("failed to reopen disk cache: %v", err)
+	}
+	defer c.Close()
+
+	if val, ok := c.Get("b"); !ok || val.Name != "b2" {
+		t.Errorf("expected value b2 after reopening, got %+v", val)
+	}
+	if s := c.Stats(); s.Size != 1 || s.Weight != size {
+		t.Errorf("expected 1 entry of %d bytes after reopening, got %+v", size, s)
+	}
+
+	if n := c.Clear(); n != 1 || c.Len() != 0 {
+		t.Errorf("expected 1 entry cleared, got %d", n)
+	}
+}
+
+func TestOpenDiskCacheBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	foreign := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(foreign, []byte("not a cache"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := cache.OpenDiskCache[diskValue](foreign, 1<<20); err == nil {
+		t.Errorf("expected a file that is not a database to be rejected")
+	}
+	if data, err := os.ReadFile(foreign); err != nil || string(data) != "not a cache" {
+		t.Errorf("expected the file to be left alone, got %q (%v)", data, err)
+	}
+
+	path := filepath.Join(dir, "cache.db")
+	c, err := cache.OpenDiskCache[diskValue](path, 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	c.Put("a", diskValue{Name: "a"})
+	c.Close()
+
+	// Break the checksums of both meta pages by changing their transaction ids.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("failed to open database file: %v", err)
+	}
+	for _, page := range []int64{0, int64(os.Getpagesize())} {
+		f.WriteAt([]byte{0xff}, page+64)
+	}
+	f.Close()
+
+	c, err = cache.OpenDiskCache[diskValue](path, 1<<20)
+	if err != nil {
+		t.Fatalf("expected a corrupted database to be recreated, got %v", err)
+	}
+	defer c.Close()
+	if c.Len() != 0 {
+		t.Errorf("expected the recreated cache to be empty, got %d entries", c.Len())
+	}
+}
+
+func TestDiskCacheMaxBytes(t *testing.T) {
+	c, err := cache.OpenDiskCache[string](filepath.Join(t.TempDir(), "cache.db"), 1000)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer c.Close()
+
+	value := strings.Repeat("x", 200)
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		c.Put(key, value)
+	}
+
+	s := c.Stats()
+	if s.Weight > 1000 || s.Evictions == 0 {
+		t.Errorf("expected oldest entries evicted to fit 1000 bytes, got %+v", s)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected the oldest key to be evicted")
+	}
+	if _, ok := c.Get("f"); !ok {
+		t.Errorf("expected the newest key to be kept")
+	}
+
+	c.Put("huge", strings.Repeat("x", 2000))
+	if _, ok := c.Get("huge"); ok {
+		t.Errorf("expected value larger than the limit not to be stored")
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	disk, err := cache.OpenDiskCache[int](filepath.Join(t.TempDir(), "cache.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	c := cache.NewTieredCache(cache.NewLRUCache(2, cache.SpillTo[string, int](disk)), disk)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Put("c", 3)
+
+	if disk.Len() != 1 {
+		t.Fatalf("expected the evicted entry to be written to disk, got %d entries", disk.Len())
+	}
+	if val, ok := c.Get("a"); !ok || val != 1 {
+		t.Errorf("expected key a from the disk tier, got %v", val)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected the in-memory tier to stay full, got %d", c.Len())
+	}
+
+	if !c.Delete("a") {
+		t.Errorf("expected key a to be deleted")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected key a to be deleted from both tiers")
+	}
+}
+
+func TestDiskCacheExpiry(t *testing.T) {
+	c, err := cache.OpenDiskCache[int](filepath.Join(t.TempDir(), "cache.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer c.Close()
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	c.Spill("fresh", 1, expiresAt, now)
+	c.Spill("stale", 2, now.Add(-time.Second), now)
+
+	if val, got, ok := c.GetWithExpiry("fresh"); !ok || val != 1 || !got.Equal(expiresAt) {
+		t.Errorf("expected value 1 expiring at %v, got %v at %v", expiresAt, val, got)
+	}
+	if _, ok := c.Get("stale"); ok {
+		t.Errorf("expected an expired value not to be returned")
+	}
+	if s := c.Stats(); s.Expirations != 1 {
+		t.Errorf("expected 1 expiration, got %+v", s)
+	}
+}
+
+func TestDiskCacheSpillAfterDelete(t *testing.T) {
+	c, err := cache.OpenDiskCache[int](filepath.Join(t.TempDir(), "cache.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer c.Close()
+
+	evictedAt := time.Now()
+	c.Delete("a")
+	c.Spill("a", 1, time.Time{}, evictedAt)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a value evicted before a delete not to be stored")
+	}
+
+	c.Spill("a", 2, time.Time{}, time.Now())
+	if val, ok := c.Get("a"); !ok || val != 2 {
+		t.Errorf("expected a value evicted after the delete to be stored, got %v", val)
+	}
+}
+
+func TestTieredCacheTTL(t *testing.T) {
+	disk, err := cache.OpenDiskCache[int](filepath.Join(t.TempDir(), "cache.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	const ttl = 100 * time.Millisecond
+	c := cache.NewTieredCache(cache.NewLRUCache(1, cache.WithTTL[string, int](ttl), cache.SpillTo[string, int](disk)), disk)
+	c.Put("a", 1)
+	c.Put("b", 2)
+
+	if val, ok := c.Get("a"); !ok || val != 1 {
+		t.Fatalf("expected key a from the disk tier, got %v", val)
+	}
+	// Moving a back to memory keeps its original expiry time, and so does spilling it again.
+	c.Put("c", 3)
+	time.Sleep(ttl)
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("expected key %s to expire in both tiers", key)
+		}
+	}
+}
+
+// blockingTier holds GetWithExpiry and Spill until release is closed, after a send on started.
+type blockingTier struct {
+	*cache.DiskCache[int]
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTier) GetWithExpiry(key string) (int, time.Time, bool) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.DiskCache.GetWithExpiry(key)
+}
+
+func (b *blockingTier) Spill(key string, value int, expiresAt, evictedAt time.Time) {
+	b.started <- struct{}{}
+	<-b.release
+	b.DiskCache.Spill(key, value, expiresAt, evictedAt)
+}
+
+func TestTieredCacheDeleteRaces(t *testing.T) {
+	disk, err := cache.OpenDiskCache[int](filepath.Join(t.TempDir(), "cache.db"), 1<<20)
+	if err != nil {
+		t.Fatalf("failed to open disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	lower := &blockingTier{DiskCache: disk, started: make(chan struct{}, 1), release: make(chan struct{})}
+	c := cache.NewTieredCache(cache.NewLRUCache(1, cache.SpillTo[string, int](lower)), lower)
+
+	// a is evicted, and deleted before it reaches the disk.
+	c.Put("a", 1)
+	done := make(chan struct{})
+	go func() {
+		c.Put("b", 2)
+		close(done)
+	}()
+	<-lower.started
+	c.Delete("a")
+	close(lower.release)
+	<-done
+	if _, ok := disk.Get("a"); ok {
+		t.Errorf("expected a deleted entry not to be spilled")
+	}
+
+	// c is read from the disk, and deleted before it is moved back to memory.
+	disk.Put("c", 3)
+	lower.release = make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		c.Get("c")
+		close(done)
+	}()
+	<-lower.started
+	c.Delete("c")
+	close(lower.release)
+	<-done
+	if slices.Contains(c.Keys(), "c") {
+		t.Errorf("expected a deleted entry not to be moved back to memory")
+	}
+}
@@ -0,0 +1,139 @@
+package cache
+
+import "slices"
+
+// NewLFUCache returns a cache that evicts the least frequently used entry, the least
+// recently used one among entries with the same frequency. Frequencies are counted from
+// the moment an entry is added and are lost when it is evicted.
+func NewLFUCache[K comparable, V any](capacity int, opts ...Option[K, V]) *Cache[K, V] {
+	return newCache(capacity, newLFUPolicy[K, V](capacity), opts...)
+}
+
+type lfuEntry[K comparable, V any] struct {
+	CacheEntry[K, V]
+	freq int
+}
+
+// lfuPolicy keeps a list of entries for every access frequency, so all operations are O(1).
+type lfuPolicy[K comparable, V any] struct {
+	capacity int
+	data     map[K]*Node[lfuEntry[K, V]]
+	freqs    map[int]*DoubleLinkedList[lfuEntry[K, V]]
+	minFreq  int
+}
+
+func newLFUPolicy[K comparable, V any](capacity int) *lfuPolicy[K, V] {
+	return &lfuPolicy[K, V]{
+		capacity: capacity,
+		data:     make(map[K]*Node[lfuEntry[K, V]]),
+		freqs:    make(map[int]*DoubleLinkedList[lfuEntry[K, V]]),
+	}
+}
+
+func (p *lfuPolicy[K, V]) get(key K) (*CacheEntry[K, V], bool) {
+	node, ok := p.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	freq := node.data.freq
+	p.unlink(node)
+	if freq == p.minFreq && p.freqs[freq] == nil {
+		p.minFreq++
+	}
+
+	node.data.freq++
+	p.link(node)
+	return &node.data.CacheEntry, true
+}
+
+func (p *lfuPolicy[K, V]) add(entry CacheEntry[K, V], evict func(entry *CacheEntry[K, V])) {
+	if len(p.data) >= p.capacity {
+		victim := p.freqs[p.minFreq].back
+		p.unlink(victim)
+		delete(p.data, victim.data.key)
+		evict(&victim.data.CacheEntry)
+	}
+
+	node := NewNode(lfuEntry[K, V]{CacheEntry: entry, freq: 1})
+	p.data[entry.key] = node
+	p.link(node)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy[K, V]) remove(key K) (CacheEntry[K, V], bool) {
+	node, ok := p.data[key]
+	if !ok {
+		return CacheEntry[K, V]{}, false
+	}
+
+	p.unlink(node)
+	delete(p.data, key)
+	if node.data.freq == p.minFreq && p.freqs[p.minFreq] == nil {
+		p.minFreq = p.lowestFreq()
+	}
+	return node.data.CacheEntry, true
+}
+
+func (p *lfuPolicy[K, V]) clear() {
+	clear(p.data)
+	clear(p.freqs)
+	p.minFreq = 0
+}
+
+func (p *lfuPolicy[K, V]) evictOne() (CacheEntry[K, V], bool) {
+	if len(p.data) == 0 {
+		return CacheEntry[K, V]{}, false
+	}
+	return p.remove(p.freqs[p.minFreq].back.data.key)
+}
+
+func (p *lfuPolicy[K, V]) len() int {
+	return len(p.data)
+}
+
+func (p *lfuPolicy[K, V]) walk(fn func(entry *CacheEntry[K, V])) {
+	for _, freq := range p.sortedFreqs() {
+		for node := p.freqs[freq].back; node != nil; node = node.prev {
+			fn(&node.data.CacheEntry)
+		}
+	}
+}
+
+func (p *lfuPolicy[K, V]) link(node *Node[lfuEntry[K, V]]) {
+	list, ok := p.freqs[node.data.freq]
+	if !ok {
+		list = NewDoubleLinkedList[lfuEntry[K, V]]()
+		p.freqs[node.data.freq] = list
+	}
+	list.PushFront(node)
+}
+
+func (p *lfuPolicy[K, V]) unlink(node *Node[lfuEntry[K, V]]) {
+	list := p.freqs[node.data.freq]
+	list.remove(node)
+	if list.Size() == 0 {
+		delete(p.freqs, node.data.freq)
+	}
+}
+
+// lowestFreq is only needed when an entry is removed other than by add, which may empty
+// the lowest frequency list. It is linear in the number of distinct frequencies.
+func (p *lfuPolicy[K, V]) lowestFreq() int {
+	lowest := 0
+	for freq := range p.freqs {
+		if lowest == 0 || freq < lowest {
+			lowest = freq
+		}
+	}
+	return lowest
+}
+
+func (p *lfuPolicy[K, V]) sortedFreqs() []int {
+	freqs := make([]int, 0, len(p.freqs))
+	for freq := range p.freqs {
+		freqs = append(freqs, freq)
+	}
+	slices.Sort(freqs)
+	return freqs
+}
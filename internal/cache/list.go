@@ -53,10 +53,12 @@ func (l *DoubleLinkedList[T]) PopFront() *Node[T] {
 
 	if l.front == l.back {
 		l.front = nil
+		l.back = nil
 	} else {
 		l.front = l.front.next
 		l.front.prev = nil
 	}
+	ret.next = nil
 	l.size--
 	return ret
 }
@@ -87,6 +89,7 @@ func (l *DoubleLinkedList[T]) PopBack() *Node[T] {
 		l.back = l.back.prev
 		l.back.next = nil
 	}
+	ret.prev = nil
 	l.size--
 	return ret
 }
@@ -0,0 +1,75 @@
+package cache
+
+// NewLRUCache returns a cache that evicts the least recently used entry.
+func NewLRUCache[K comparable, V any](capacity int, opts ...Option[K, V]) *Cache[K, V] {
+	return newCache(capacity, newLRUPolicy[K, V](capacity), opts...)
+}
+
+type lruPolicy[K comparable, V any] struct {
+	capacity int
+	data     map[K]*Node[CacheEntry[K, V]]
+	list     *DoubleLinkedList[CacheEntry[K, V]]
+}
+
+func newLRUPolicy[K comparable, V any](capacity int) *lruPolicy[K, V] {
+	return &lruPolicy[K, V]{
+		capacity: capacity,
+		data:     make(map[K]*Node[CacheEntry[K, V]]),
+		list:     NewDoubleLinkedList[CacheEntry[K, V]](),
+	}
+}
+
+func (p *lruPolicy[K, V]) get(key K) (*CacheEntry[K, V], bool) {
+	node, ok := p.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	p.list.MoveToFront(node)
+	return &node.data, true
+}
+
+func (p *lruPolicy[K, V]) add(entry CacheEntry[K, V], evict func(entry *CacheEntry[K, V])) {
+	node := NewNode(entry)
+	p.list.PushFront(node)
+	p.data[entry.key] = node
+
+	for p.list.Size() > p.capacity {
+		node := p.list.PopBack()
+		delete(p.data, node.data.key)
+		evict(&node.data)
+	}
+}
+
+func (p *lruPolicy[K, V]) remove(key K) (CacheEntry[K, V], bool) {
+	node, ok := p.data[key]
+	if !ok {
+		return CacheEntry[K, V]{}, false
+	}
+
+	p.list.remove(node)
+	delete(p.data, key)
+	return node.data, true
+}
+
+func (p *lruPolicy[K, V]) clear() {
+	clear(p.data)
+	p.list = NewDoubleLinkedList[CacheEntry[K, V]]()
+}
+
+func (p *lruPolicy[K, V]) evictOne() (CacheEntry[K, V], bool) {
+	if p.list.back == nil {
+		return CacheEntry[K, V]{}, false
+	}
+	return p.remove(p.list.back.data.key)
+}
+
+func (p *lruPolicy[K, V]) len() int {
+	return p.list.Size()
+}
+
+func (p *lruPolicy[K, V]) walk(fn func(entry *CacheEntry[K, V])) {
+	for node := p.list.back; node != nil; node = node.prev {
+		fn(&node.data)
+	}
+}
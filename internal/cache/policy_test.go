@@ -0,0 +1,107 @@
+package cache_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"webtechl0/internal/cache"
+)
+
+func TestLFUCache(t *testing.T) {
+	c := cache.NewLFUCache[string, int](2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Get("a")
+	c.Get("a")
+
+	c.Put("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected least frequently used key b to be evicted")
+	}
+
+	// c and a now have frequencies 1 and 3, so c goes next.
+	c.Put("d", 4)
+	if _, ok := c.Get("c"); ok {
+		t.Errorf("expected key c to be evicted")
+	}
+	if val, ok := c.Get("a"); !ok || val != 1 {
+		t.Errorf("expected frequently used key a to stay, got %v", val)
+	}
+
+	if !c.Delete("a") || c.Delete("a") {
+		t.Errorf("expected key a to be deleted once")
+	}
+	c.Put("e", 5)
+	if val, ok := c.Get("d"); !ok || val != 4 {
+		t.Errorf("expected key d to stay after delete, got %v", val)
+	}
+}
+
+func TestTinyLFUCacheResistsScans(t *testing.T) {
+	const capacity = 100
+
+	hot := make([]string, 20)
+	for i := range hot {
+		hot[i] = "hot-" + strconv.Itoa(i)
+	}
+
+	// The hot keys are requested again only after scans of one-off keys larger than the
+	// cache, which push them out of an LRU cache every time.
+	run := func(c *cache.Cache[string, int]) (hits int) {
+		lookup := func(key string, value int) {
+			if _, ok := c.Get(key); ok {
+				hits++
+				return
+			}
+			c.Put(key, value)
+		}
+
+		for range 5 {
+			for i, key := range hot {
+				lookup(key, i)
+			}
+		}
+		for round := range 5 {
+			for i := range 2 * capacity {
+				lookup("scan-"+strconv.Itoa(round*2*capacity+i), i)
+			}
+			for i, key := range hot {
+				lookup(key, i)
+			}
+		}
+		return hits
+	}
+
+	lru := run(cache.NewLRUCache[string, int](capacity))
+	tinyLFU := run(cache.NewTinyLFUCache[string, int](capacity))
+
+	// Both hit on the repeated warm-up rounds, only TinyLFU keeps the hot keys across scans.
+	// Its frequency estimates are approximate, so allow for a few unlucky hash collisions.
+	if want := 4 * len(hot); lru != want {
+		t.Errorf("expected %d LRU hits, got %d", want, lru)
+	}
+	if want := 9*len(hot) - 5; tinyLFU < want {
+		t.Errorf("expected at least %d TinyLFU hits, got %d", want, tinyLFU)
+	}
+}
+
+func TestNewCachePolicy(t *testing.T) {
+	for _, policy := range []cache.Policy{cache.PolicyLRU, cache.PolicyLFU, cache.PolicyTinyLFU} {
+		c, err := cache.New[int, int](policy, 10)
+		if err != nil {
+			t.Fatalf("failed to create %s cache: %v", policy, err)
+		}
+
+		for i := range 20 {
+			c.Put(i, i)
+		}
+		if s := c.Stats(); s.Size != 10 || s.Evictions != 10 {
+			t.Errorf("%s: expected 10 entries and 10 evictions, got %+v", policy, s)
+		}
+	}
+
+	if _, err := cache.New[int, int]("fifo", 10); !errors.Is(err, cache.ErrUnknownPolicy) {
+		t.Errorf("expected ErrUnknownPolicy, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"hash/maphash"
+	"slices"
+	"time"
+)
+
+// ShardedCache spreads keys over several independent caches, each with its own lock and
+// an equal share of the capacity, so concurrent access to different keys rarely contends
+// on the same mutex. The eviction policy is applied per shard, so eviction is only
+// approximately LRU, LFU or TinyLFU across the whole cache.
+type ShardedCache[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards []*Cache[K, V]
+}
+
+func NewShardedLRUCache[K comparable, V any](capacity, shards int, opts ...Option[K, V]) *ShardedCache[K, V] {
+	c, _ := NewShardedCache(PolicyLRU, capacity, shards, opts...)
+	return c
+}
+
+// NewShardedCache returns a sharded cache with the given eviction policy. A weight limit
+// set WithMaxWeight is split between the shards like the capacity.
+func NewShardedCache[K comparable, V any](policy Policy, capacity, shards int, opts ...Option[K, V]) (*ShardedCache[K, V], error) {
+	if shards > capacity {
+		shards = capacity
+	}
+	if shards < 1 {
+		shards = 1
+	}
+
+	c := &ShardedCache[K, V]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*Cache[K, V], shards),
+	}
+
+	for i := range c.shards {
+		shardCapacity := capacity / shards
+		if i < capacity%shards {
+			shardCapacity++
+		}
+
+		shard, err := New(policy, shardCapacity, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if shard.maxWeight > 0 {
+			shard.maxWeight = max(1, shard.maxWeight/int64(shards))
+		}
+		c.shards[i] = shard
+	}
+
+	return c, nil
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *Cache[K, V] {
+	return c.shards[c.shardIndex(key)]
+}
+
+func (c *ShardedCache[K, V]) shardIndex(key K) uint64 {
+	return maphash.Comparable(c.seed, key) % uint64(len(c.shards))
+}
+
+func (c *ShardedCache[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).Get(key)
+}
+
+func (c *ShardedCache[K, V]) Put(key K, value V) {
+	c.shard(key).Put(key, value)
+}
+
+func (c *ShardedCache[K, V]) PutWithTTL(key K, value V, ttl time.Duration) {
+	c.shard(key).PutWithTTL(key, value, ttl)
+}
+
+func (c *ShardedCache[K, V]) Delete(key K) bool {
+	return c.shard(key).Delete(key)
+}
+
+func (c *ShardedCache[K, V]) Len() int {
+	n := 0
+	for _, shard := range c.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+func (c *ShardedCache[K, V]) Clear() int {
+	n := 0
+	for _, shard := range c.shards {
+		n += shard.Clear()
+	}
+	return n
+}
+
+// Range calls fn for the live entries shard by shard, in the order of Cache.Range within
+// each shard, until fn returns false.
+func (c *ShardedCache[K, V]) Range(fn func(key K, value V) bool) {
+	for _, shard := range c.shards {
+		stopped := false
+		shard.Range(func(key K, value V) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns the keys of the live entries, see Entries for the order.
+func (c *ShardedCache[K, V]) Keys() []K {
+	entries := c.Entries()
+	keys := make([]K, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+// Entries returns the live entries of all shards from the most to the least recently accessed.
+func (c *ShardedCache[K, V]) Entries() []EntryInfo[K] {
+	var entries []EntryInfo[K]
+	for _, shard := range c.shards {
+		entries = append(entries, shard.Entries()...)
+	}
+	slices.SortStableFunc(entries, func(a, b EntryInfo[K]) int {
+		return b.AccessedAt.Compare(a.AccessedAt)
+	})
+	return entries
+}
+
+// Stats returns the sum of the statistics of all shards.
+func (c *ShardedCache[K, V]) Stats() Stats {
+	var total Stats
+	for _, shard := range c.shards {
+		s := shard.Stats()
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+		total.Evictions += s.Evictions
+		total.Expirations += s.Expirations
+		total.Size += s.Size
+		total.Capacity += s.Capacity
+		total.Weight += s.Weight
+		total.MaxWeight += s.MaxWeight
+		total.Errors += s.Errors
+	}
+	return total
+}
+
+// SaveSnapshot writes the entries of all shards to the file at path, see Cache.SaveSnapshot.
+// Recency order is kept within each shard.
+func (c *ShardedCache[K, V]) SaveSnapshot(path string) error {
+	var entries []snapshotEntry[K, V]
+	for _, shard := range c.shards {
+		entries = append(entries, shard.snapshot()...)
+	}
+	return saveSnapshot(path, entries)
+}
+
+// LoadSnapshot restores the entries saved with SaveSnapshot, see Cache.LoadSnapshot.
+// The snapshot may come from a cache with a different number of shards.
+func (c *ShardedCache[K, V]) LoadSnapshot(path string, maxAge time.Duration) (int, error) {
+	entries, err := loadSnapshot[K, V](path, maxAge)
+	if err != nil {
+		return 0, err
+	}
+
+	perShard := make([][]snapshotEntry[K, V], len(c.shards))
+	for _, entry := range entries {
+		i := c.shardIndex(entry.Key)
+		perShard[i] = append(perShard[i], entry)
+	}
+
+	now := time.Now()
+	restored := 0
+	for i, shard := range c.shards {
+		restored += shard.restore(perShard[i], now)
+	}
+	return restored, nil
+}
+
+func (c *ShardedCache[K, V]) Close() {
+	for _, shard := range c.shards {
+		shard.Close()
+	}
+}
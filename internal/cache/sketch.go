@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	sketchDepth       = 4
+	sketchWidthFactor = 4
+	sketchMaxCount    = 15
+	sketchSampleSize  = 10
+)
+
+// countMinSketch estimates how often keys were seen in a fixed amount of memory, 16 bytes
+// per entry of the cache. Counters saturate at 15 and are halved once every
+// sketchSampleSize increments per entry, so the estimates follow recent popularity.
+type countMinSketch[K comparable] struct {
+	seed      maphash.Seed
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch[K comparable](capacity int) *countMinSketch[K] {
+	capacity = max(capacity, 16)
+	width := 1 << bits.Len(uint(capacity*sketchWidthFactor-1))
+
+	s := &countMinSketch[K]{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: sketchSampleSize * capacity,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch[K]) increment(key K) {
+	h := maphash.Comparable(s.seed, key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch[K]) estimate(key K) uint8 {
+	h := maphash.Comparable(s.seed, key)
+	estimate := uint8(sketchMaxCount)
+	for i := range s.rows {
+		estimate = min(estimate, s.rows[i][s.index(h, i)])
+	}
+	return estimate
+}
+
+// index derives the counter of row i from the two halves of the hash.
+func (s *countMinSketch[K]) index(h uint64, i int) uint64 {
+	return (h + uint64(i)*(h>>32)) & s.mask
+}
+
+func (s *countMinSketch[K]) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] /= 2
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot file layout: a fixed size header followed by the gob encoded entries, from the
+// first to the last candidate for eviction. The header holds the CRC-32C of the payload.
+const (
+	snapshotMagic   = "LRUS"
+	snapshotVersion = 1
+)
+
+var (
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	ErrSnapshotStale   = errors.New("snapshot is stale")
+)
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotHeader struct {
+	Magic     [4]byte
+	Version   uint32
+	CreatedAt int64
+	Length    uint64
+	Checksum  uint32
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	Key       K
+	Value     V
+	ExpiresAt time.Time
+}
+
+// SaveSnapshot writes the entries of the cache to the file at path. The file is replaced
+// atomically, so a crash while saving leaves the previous snapshot intact.
+func (c *Cache[K, V]) SaveSnapshot(path string) error {
+	return saveSnapshot(path, c.snapshot())
+}
+
+// LoadSnapshot restores the entries saved with SaveSnapshot and returns how many were restored.
+// A snapshot older than maxAge is rejected with ErrSnapshotStale, zero maxAge disables the check.
+// Entries that expired since the snapshot was taken are skipped.
+func (c *Cache[K, V]) LoadSnapshot(path string, maxAge time.Duration) (int, error) {
+	entries, err := loadSnapshot[K, V](path, maxAge)
+	if err != nil {
+		return 0, err
+	}
+	return c.restore(entries, time.Now()), nil
+}
+
+// snapshot returns the live entries from the first to the last candidate for eviction.
+func (c *Cache[K, V]) snapshot() []snapshotEntry[K, V] {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	entries := make([]snapshotEntry[K, V], 0, c.policy.len())
+	c.policy.walk(func(entry *CacheEntry[K, V]) {
+		if entry.expired(now) {
+			return
+		}
+		entries = append(entries, snapshotEntry[K, V]{
+			Key:       entry.key,
+			Value:     entry.value,
+			ExpiresAt: entry.expiresAt,
+		})
+	})
+	return entries
+}
+
+func (c *Cache[K, V]) restore(entries []snapshotEntry[K, V], now time.Time) int {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	if c.capacity == 0 {
+		return 0
+	}
+
+	// Entries rejected by the policy or already present are not counted as restored.
+	before := c.policy.len()
+	for _, entry := range entries {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			continue
+		}
+		c.put(entry.Key, entry.Value, entry.ExpiresAt)
+	}
+	return max(0, c.policy.len()-before)
+}
+
+func saveSnapshot[K comparable, V any](path string, entries []snapshotEntry[K, V]) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(entries); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	header := snapshotHeader{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UnixNano(),
+		Length:    uint64(payload.Len()),
+		Checksum:  crc32.Checksum(payload.Bytes(), snapshotTable),
+	}
+	copy(header.Magic[:], snapshotMagic)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if _, err := payload.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
+
+func loadSnapshot[K comparable, V any](path string, maxAge time.Duration) ([]snapshotEntry[K, V], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var header snapshotHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %w", ErrSnapshotCorrupt, err)
+	}
+	if string(header.Magic[:]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: unknown file format", ErrSnapshotCorrupt)
+	}
+	if header.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+
+	createdAt := time.Unix(0, header.CreatedAt)
+	if age := time.Since(createdAt); maxAge > 0 && age > maxAge {
+		return nil, fmt.Errorf("%w: taken %s ago", ErrSnapshotStale, age.Round(time.Second))
+	}
+
+	if info, err := f.Stat(); err == nil && header.Length > uint64(info.Size()) {
+		return nil, fmt.Errorf("%w: payload is truncated", ErrSnapshotCorrupt)
+	}
+
+	payload := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: failed to read payload: %w", ErrSnapshotCorrupt, err)
+	}
+	if crc32.Checksum(payload, snapshotTable) != header.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+
+	var entries []snapshotEntry[K, V]
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode payload: %w", ErrSnapshotCorrupt, err)
+	}
+	return entries, nil
+}
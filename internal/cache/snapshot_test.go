@@ -0,0 +1,109 @@
+package cache_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"webtechl0/internal/cache"
+)
+
+func TestLRUCacheSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c := cache.NewLRUCache[string, int](3)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Put("c", 3)
+	c.Get("a")
+
+	if err := c.SaveSnapshot(path); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	restored := cache.NewLRUCache[string, int](3)
+	n, err := restored.LoadSnapshot(path, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 restored entries, got %d", n)
+	}
+
+	// Recency order is kept, so b is the least recently used and evicted first.
+	restored.Put("d", 4)
+	if _, ok := restored.Get("b"); ok {
+		t.Errorf("expected key b to be evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3, "d": 4} {
+		if val, ok := restored.Get(key); !ok || val != want {
+			t.Errorf("expected key %s to have value %d, got %v", key, want, val)
+		}
+	}
+}
+
+func TestLRUCacheSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.snapshot")
+
+	c := cache.NewLRUCache[string, int](10)
+	c.Put("a", 1)
+
+	if _, err := c.LoadSnapshot(filepath.Join(dir, "missing"), 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if err := c.SaveSnapshot(path); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.LoadSnapshot(path, time.Millisecond); !errors.Is(err, cache.ErrSnapshotStale) {
+		t.Errorf("expected ErrSnapshotStale, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	if _, err := c.LoadSnapshot(path, 0); !errors.Is(err, cache.ErrSnapshotCorrupt) {
+		t.Errorf("expected ErrSnapshotCorrupt, got %v", err)
+	}
+
+	if err := os.WriteFile(path, data[:10], 0o600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if _, err := c.LoadSnapshot(path, 0); !errors.Is(err, cache.ErrSnapshotCorrupt) {
+		t.Errorf("expected ErrSnapshotCorrupt for truncated file, got %v", err)
+	}
+}
+
+func TestShardedLRUCacheSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c := cache.NewShardedLRUCache[int, int](400, 4)
+	for i := range 100 {
+		c.Put(i, i)
+	}
+	if err := c.SaveSnapshot(path); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	restored := cache.NewShardedLRUCache[int, int](400, 8)
+	if n, err := restored.LoadSnapshot(path, 0); err != nil || n != 100 {
+		t.Fatalf("expected 100 restored entries, got %d, error %v", n, err)
+	}
+	for i := range 100 {
+		if val, ok := restored.Get(i); !ok || val != i {
+			t.Errorf("expected key %d to have value %d, got %v", i, i, val)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tier is a lower cache level behind an in-memory cache, such as DiskCache.
+type Tier[K comparable, V any] interface {
+	// GetWithExpiry returns the value and when it expires, zero if it never does.
+	GetWithExpiry(key K) (V, time.Time, bool)
+	// Spill stores a value evicted from memory at evictedAt, unless the tier has had a
+	// Delete or Clear since then, which the evicted value could otherwise outlive.
+	Spill(key K, value V, expiresAt, evictedAt time.Time)
+	Delete(key K) bool
+	Clear() int
+}
+
+// memoryTier is what TieredCache needs from the first level, Cache and ShardedCache both fit.
+type memoryTier[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(key K, value V)
+	PutWithTTL(key K, value V, ttl time.Duration)
+	Delete(key K) bool
+	Len() int
+	Clear() int
+	Range(fn func(key K, value V) bool)
+	Keys() []K
+	Entries() []EntryInfo[K]
+	Stats() Stats
+	SaveSnapshot(path string) error
+	LoadSnapshot(path string, maxAge time.Duration) (int, error)
+	Close()
+}
+
+// SpillTo makes the cache write entries evicted for lack of capacity to the lower tier, along
+// with their expiry time. Expired, deleted and replaced entries are not written. Like eviction
+// callbacks, writes run after the cache mutex is released.
+func SpillTo[K comparable, V any](lower Tier[K, V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.lower = lower
+	}
+}
+
+// TieredCache looks entries up in an in-memory cache first and then in a lower tier, moving
+// entries found there back to memory. The in-memory cache should be created with SpillTo,
+// so that what it evicts ends up in the lower tier. All other methods, including Len, Stats
+// and snapshots, apply to the in-memory cache only.
+type TieredCache[K comparable, V any] struct {
+	memoryTier[K, V]
+	lower Tier[K, V]
+
+	// mutex serialises deletes with moving entries back to memory, and gen counts deletes,
+	// so that an entry read from the lower tier is not moved back once it has been deleted.
+	mutex sync.Mutex
+	gen   atomic.Uint64
+}
+
+func NewTieredCache[K comparable, V any](memory memoryTier[K, V], lower Tier[K, V]) *TieredCache[K, V] {
+	return &TieredCache[K, V]{memoryTier: memory, lower: lower}
+}
+
+// Get moves an entry found in the lower tier back to memory with the time it has left, unless
+// a Delete or Clear ran meanwhile.
+func (c *TieredCache[K, V]) Get(key K) (V, bool) {
+	if value, ok := c.memoryTier.Get(key); ok {
+		return value, true
+	}
+
+	gen := c.gen.Load()
+	value, expiresAt, ok := c.lower.GetWithExpiry(key)
+	if !ok {
+		return value, false
+	}
+
+	var ttl time.Duration
+	if !expiresAt.IsZero() {
+		if ttl = time.Until(expiresAt); ttl <= 0 {
+			var zero V
+			return zero, false
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.gen.Load() == gen {
+		c.memoryTier.PutWithTTL(key, value, ttl)
+	}
+	return value, true
+}
+
+// Delete removes the key from both tiers and reports whether either had it.
+func (c *TieredCache[K, V]) Delete(key K) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.gen.Add(1)
+	inMemory := c.memoryTier.Delete(key)
+	inLower := c.lower.Delete(key)
+	return inMemory || inLower
+}
+
+// Clear empties both tiers and returns how many entries the in-memory cache had.
+func (c *TieredCache[K, V]) Clear() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.gen.Add(1)
+	n := c.memoryTier.Clear()
+	c.lower.Clear()
+	return n
+}
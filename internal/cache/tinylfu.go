@@ -0,0 +1,176 @@
+package cache
+
+// NewTinyLFUCache returns a W-TinyLFU cache. New entries go to a small LRU window, about 1%
+// of the capacity. An entry leaving the window is admitted to the main segmented LRU only if
+// it has been requested more often than the entry it would evict, as estimated by a
+// count-min sketch of recent lookups. This keeps frequently used entries from being pushed
+// out by scans of entries used once.
+func NewTinyLFUCache[K comparable, V any](capacity int, opts ...Option[K, V]) *Cache[K, V] {
+	return newCache(capacity, newTinyLFUPolicy[K, V](capacity), opts...)
+}
+
+type tinyLFUSegment uint8
+
+const (
+	segmentWindow tinyLFUSegment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUEntry[K comparable, V any] struct {
+	CacheEntry[K, V]
+	segment tinyLFUSegment
+}
+
+// tinyLFUPolicy splits the main segment into probation, for entries admitted from the
+// window, and protected, for entries requested again while on probation, about 80% of it.
+type tinyLFUPolicy[K comparable, V any] struct {
+	data      map[K]*Node[tinyLFUEntry[K, V]]
+	window    *DoubleLinkedList[tinyLFUEntry[K, V]]
+	probation *DoubleLinkedList[tinyLFUEntry[K, V]]
+	protected *DoubleLinkedList[tinyLFUEntry[K, V]]
+	sketch    *countMinSketch[K]
+
+	windowCapacity    int
+	mainCapacity      int
+	protectedCapacity int
+}
+
+func newTinyLFUPolicy[K comparable, V any](capacity int) *tinyLFUPolicy[K, V] {
+	windowCapacity := max(1, capacity/100)
+	mainCapacity := max(0, capacity-windowCapacity)
+
+	return &tinyLFUPolicy[K, V]{
+		data:              make(map[K]*Node[tinyLFUEntry[K, V]]),
+		window:            NewDoubleLinkedList[tinyLFUEntry[K, V]](),
+		probation:         NewDoubleLinkedList[tinyLFUEntry[K, V]](),
+		protected:         NewDoubleLinkedList[tinyLFUEntry[K, V]](),
+		sketch:            newCountMinSketch[K](capacity),
+		windowCapacity:    windowCapacity,
+		mainCapacity:      mainCapacity,
+		protectedCapacity: mainCapacity * 8 / 10,
+	}
+}
+
+// get records every lookup in the sketch, misses included, since a key that keeps missing
+// is one worth admitting once it is loaded.
+func (p *tinyLFUPolicy[K, V]) get(key K) (*CacheEntry[K, V], bool) {
+	p.sketch.increment(key)
+
+	node, ok := p.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	switch node.data.segment {
+	case segmentWindow:
+		p.window.MoveToFront(node)
+	case segmentProtected:
+		p.protected.MoveToFront(node)
+	case segmentProbation:
+		p.probation.remove(node)
+		node.data.segment = segmentProtected
+		p.protected.PushFront(node)
+
+		if p.protected.Size() > p.protectedCapacity {
+			demoted := p.protected.PopBack()
+			demoted.data.segment = segmentProbation
+			p.probation.PushFront(demoted)
+		}
+	}
+
+	return &node.data.CacheEntry, true
+}
+
+func (p *tinyLFUPolicy[K, V]) add(entry CacheEntry[K, V], evict func(entry *CacheEntry[K, V])) {
+	node := NewNode(tinyLFUEntry[K, V]{CacheEntry: entry, segment: segmentWindow})
+	p.data[entry.key] = node
+	p.window.PushFront(node)
+
+	if p.window.Size() > p.windowCapacity {
+		p.admit(p.window.PopBack(), evict)
+	}
+}
+
+// admit moves the candidate evicted from the window to the main segment, evicting either
+// the candidate or the least recently used entry of the main segment when it is full.
+func (p *tinyLFUPolicy[K, V]) admit(candidate *Node[tinyLFUEntry[K, V]], evict func(entry *CacheEntry[K, V])) {
+	if p.probation.Size()+p.protected.Size() < p.mainCapacity {
+		candidate.data.segment = segmentProbation
+		p.probation.PushFront(candidate)
+		return
+	}
+
+	victim := p.probation.back
+	if victim == nil {
+		victim = p.protected.back
+	}
+
+	if victim == nil || p.sketch.estimate(candidate.data.key) <= p.sketch.estimate(victim.data.key) {
+		delete(p.data, candidate.data.key)
+		evict(&candidate.data.CacheEntry)
+		return
+	}
+
+	if entry, ok := p.remove(victim.data.key); ok {
+		evict(&entry)
+	}
+	candidate.data.segment = segmentProbation
+	p.probation.PushFront(candidate)
+}
+
+func (p *tinyLFUPolicy[K, V]) remove(key K) (CacheEntry[K, V], bool) {
+	node, ok := p.data[key]
+	if !ok {
+		return CacheEntry[K, V]{}, false
+	}
+
+	p.segment(node.data.segment).remove(node)
+	delete(p.data, key)
+	return node.data.CacheEntry, true
+}
+
+// clear keeps the sketch, the frequencies it has seen are still valid for admission.
+func (p *tinyLFUPolicy[K, V]) clear() {
+	clear(p.data)
+	p.window = NewDoubleLinkedList[tinyLFUEntry[K, V]]()
+	p.probation = NewDoubleLinkedList[tinyLFUEntry[K, V]]()
+	p.protected = NewDoubleLinkedList[tinyLFUEntry[K, V]]()
+}
+
+// evictOne evicts in the same order as walk: probation first, then window, then protected.
+func (p *tinyLFUPolicy[K, V]) evictOne() (CacheEntry[K, V], bool) {
+	for _, list := range p.evictionOrder() {
+		if list.back != nil {
+			return p.remove(list.back.data.key)
+		}
+	}
+	return CacheEntry[K, V]{}, false
+}
+
+func (p *tinyLFUPolicy[K, V]) len() int {
+	return len(p.data)
+}
+
+func (p *tinyLFUPolicy[K, V]) walk(fn func(entry *CacheEntry[K, V])) {
+	for _, list := range p.evictionOrder() {
+		for node := list.back; node != nil; node = node.prev {
+			fn(&node.data.CacheEntry)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K, V]) evictionOrder() [3]*DoubleLinkedList[tinyLFUEntry[K, V]] {
+	return [3]*DoubleLinkedList[tinyLFUEntry[K, V]]{p.probation, p.window, p.protected}
+}
+
+func (p *tinyLFUPolicy[K, V]) segment(segment tinyLFUSegment) *DoubleLinkedList[tinyLFUEntry[K, V]] {
+	switch segment {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
@@ -10,13 +10,49 @@ type Config struct {
 	HTTP     HTTP     `yaml:"server"`
 	Database Database `yaml:"database"`
 	Kafka    Kafka    `yaml:"kafka"`
+	Tracing  Tracing  `yaml:"tracing"`
 
-	CacheCapacity int `yaml:"cache_capacity" env:"CACHE_CAPACITY" env-default:"100"`
+	CacheCapacity        int           `yaml:"cache_capacity" env:"CACHE_CAPACITY" env-default:"100"`
+	CachePolicy          string        `yaml:"cache_policy" env:"CACHE_POLICY" env-default:"lru"`
+	CacheTTL             time.Duration `yaml:"cache_ttl" env:"CACHE_TTL" env-default:"0"`
+	CacheJanitorInterval time.Duration `yaml:"cache_janitor_interval" env:"CACHE_JANITOR_INTERVAL" env-default:"1m"`
+	CacheShards          int           `yaml:"cache_shards" env:"CACHE_SHARDS" env-default:"1"`
+	CacheWriteThrough    bool          `yaml:"cache_write_through" env:"CACHE_WRITE_THROUGH" env-default:"true"`
+
+	// CacheMaxBytes bounds the estimated memory used by cached orders, zero disables the limit.
+	// CacheCapacity still limits the number of orders.
+	CacheMaxBytes int64 `yaml:"cache_max_bytes" env:"CACHE_MAX_BYTES" env-default:"0"`
+
+	// CacheDiskPath enables an on-disk second cache tier for orders evicted from memory.
+	CacheDiskPath     string `yaml:"cache_disk_path" env:"CACHE_DISK_PATH"`
+	CacheDiskMaxBytes int64  `yaml:"cache_disk_max_bytes" env:"CACHE_DISK_MAX_BYTES" env-default:"1073741824"`
+
+	// CacheSnapshotPath enables saving the cache on shutdown and restoring it on startup.
+	CacheSnapshotPath   string        `yaml:"cache_snapshot_path" env:"CACHE_SNAPSHOT_PATH"`
+	CacheSnapshotMaxAge time.Duration `yaml:"cache_snapshot_max_age" env:"CACHE_SNAPSHOT_MAX_AGE" env-default:"1h"`
+
+	NegativeCacheCapacity int           `yaml:"negative_cache_capacity" env:"NEGATIVE_CACHE_CAPACITY" env-default:"10000"`
+	NegativeCacheTTL      time.Duration `yaml:"negative_cache_ttl" env:"NEGATIVE_CACHE_TTL" env-default:"30s"`
 }
 
 type HTTP struct {
 	Host string `yaml:"host" env:"SERVER_HOST" env-default:"localhost"`
 	Port string `yaml:"port" env:"SERVER_PORT" env-default:"8888"`
+
+	// AdminToken enables the /admin endpoints, which require it as a bearer token.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN"`
+
+	// ShutdownDelay is how long the service keeps serving while reported not ready on
+	// shutdown, so that load balancers stop sending traffic before the server stops.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" env-default:"5s"`
+
+	// IdempotencyKeyCapacity bounds the responses to POST /orders kept for Idempotency-Key
+	// replays, zero disables the header.
+	IdempotencyKeyCapacity int           `yaml:"idempotency_key_capacity" env:"IDEMPOTENCY_KEY_CAPACITY" env-default:"10000"`
+	IdempotencyKeyTTL      time.Duration `yaml:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL" env-default:"24h"`
+	// IdempotencyMaxBytes bounds the memory taken by the saved responses, the least recently
+	// used are dropped first. Zero means no bound.
+	IdempotencyMaxBytes int64 `yaml:"idempotency_max_bytes" env:"IDEMPOTENCY_MAX_BYTES" env-default:"67108864"`
 }
 
 type Database struct {
@@ -36,6 +72,33 @@ type Kafka struct {
 	Brokers []string `yaml:"brokers" env:"KAFKA_BROKERS"`
 	Topic   string   `yaml:"topic" env:"KAFKA_TOPIC"`
 	GroupID string   `yaml:"group_id" env:"KAFKA_GROUP_ID"`
+
+	DeadLetterTopic string `yaml:"dead_letter_topic" env:"KAFKA_DEAD_LETTER_TOPIC"`
+	Workers         int    `yaml:"workers" env:"KAFKA_WORKERS" env-default:"4"`
+
+	// BatchSize enables batch mode when greater than 1: each worker collects up to BatchSize
+	// messages or waits BatchLinger after the first one and saves them in one transaction.
+	BatchSize   int           `yaml:"batch_size" env:"KAFKA_BATCH_SIZE" env-default:"0"`
+	BatchLinger time.Duration `yaml:"batch_linger" env:"KAFKA_BATCH_LINGER" env-default:"100ms"`
+
+	RetryMaxAttempts    int           `yaml:"retry_max_attempts" env:"KAFKA_RETRY_MAX_ATTEMPTS" env-default:"10"`
+	RetryInitialBackoff time.Duration `yaml:"retry_initial_backoff" env:"KAFKA_RETRY_INITIAL_BACKOFF" env-default:"100ms"`
+	RetryMaxBackoff     time.Duration `yaml:"retry_max_backoff" env:"KAFKA_RETRY_MAX_BACKOFF" env-default:"30s"`
+	RetryMultiplier     float64       `yaml:"retry_multiplier" env:"KAFKA_RETRY_MULTIPLIER" env-default:"2"`
+	RetryJitter         float64       `yaml:"retry_jitter" env:"KAFKA_RETRY_JITTER" env-default:"0.2"`
+
+	// HealthMaxLag is the total lag above which the service is reported not ready, zero
+	// disables the check.
+	HealthMaxLag int64 `yaml:"health_max_lag" env:"KAFKA_HEALTH_MAX_LAG" env-default:"10000"`
+}
+
+type Tracing struct {
+	// Exporter is otlp, stdout or none. With none trace IDs are still generated for logs.
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_OTLP_INSECURE" env-default:"true"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" env-default:"order-service"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
 }
 
 func New(path string) (*Config, error) {
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"webtechl0/internal/cache"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type AdminService interface {
+	InvalidateOrder(orderUID string) bool
+	PurgeCache() int
+	RewarmCache(ctx context.Context) error
+	CachedOrders() []cache.EntryInfo[string]
+}
+
+// AdminHandler serves cache maintenance endpoints. Every request must carry the admin token
+// as a bearer token.
+type AdminHandler struct {
+	// ctx outlives requests, background work started by them runs until it is cancelled.
+	ctx          context.Context
+	adminService AdminService
+	token        string
+	lg           *slog.Logger
+}
+
+// NewAdminHandler creates an admin handler whose background work, such as a cache re-warm,
+// is cancelled along with ctx.
+func NewAdminHandler(ctx context.Context, adminService AdminService, token string, lg *slog.Logger) *AdminHandler {
+	return &AdminHandler{ctx: ctx, adminService: adminService, token: token, lg: lg}
+}
+
+// Authorize rejects requests without the admin token with 401.
+func (h *AdminHandler) Authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			h.lg.WarnContext(r.Context(), "Unauthorized admin request", slog.String("op", "AdminHandler.Authorize"), slog.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeErrorBody(w, r, h.lg, http.StatusUnauthorized, ErrorBody{Code: CodeUnauthorized, Message: "Unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+type invalidateResponse struct {
+	OrderUID string `json:"order_uid"`
+	Evicted  bool   `json:"evicted"`
+}
+
+func (h *AdminHandler) InvalidateOrder(w http.ResponseWriter, r *http.Request) {
+	op := "AdminHandler.InvalidateOrder"
+	orderUID := r.PathValue("order_uid")
+	log := h.lg.With(slog.String("op", op), slog.String("order_uid", orderUID))
+
+	evicted := h.adminService.InvalidateOrder(orderUID)
+	log.InfoContext(r.Context(), "Order invalidated", slog.Bool("evicted", evicted))
+
+	writeJSON(w, r, log, http.StatusOK, invalidateResponse{OrderUID: orderUID, Evicted: evicted})
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (h *AdminHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	op := "AdminHandler.PurgeCache"
+	log := h.lg.With(slog.String("op", op))
+
+	purged := h.adminService.PurgeCache()
+	log.InfoContext(r.Context(), "Cache purged", slog.Int("purged", purged))
+
+	writeJSON(w, r, log, http.StatusOK, purgeResponse{Purged: purged})
+}
+
+// RewarmCache starts a re-warm and responds with 202 without waiting for it, the progress
+// is reported on /readyz. It responds with 409 while another warm-up is running.
+func (h *AdminHandler) RewarmCache(w http.ResponseWriter, r *http.Request) {
+	op := "AdminHandler.RewarmCache"
+	log := h.lg.With(slog.String("op", op))
+
+	// The re-warm outlives the request but not the server, its logs keep the request's trace.
+	ctx := trace.ContextWithSpanContext(h.ctx, trace.SpanContextFromContext(r.Context()))
+	if err := h.adminService.RewarmCache(ctx); err != nil {
+		writeError(w, r, log, err)
+		return
+	}
+
+	log.InfoContext(r.Context(), "Cache re-warm started")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type cachedOrder struct {
+	OrderUID   string    `json:"order_uid"`
+	AccessedAt time.Time `json:"accessed_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+}
+
+type cachedOrdersResponse struct {
+	Count  int           `json:"count"`
+	Orders []cachedOrder `json:"orders"`
+}
+
+// ListCachedOrders lists the cached order UIDs, the least likely to be evicted first.
+func (h *AdminHandler) ListCachedOrders(w http.ResponseWriter, r *http.Request) {
+	op := "AdminHandler.ListCachedOrders"
+	log := h.lg.With(slog.String("op", op))
+
+	entries := h.adminService.CachedOrders()
+	resp := cachedOrdersResponse{Count: len(entries), Orders: make([]cachedOrder, len(entries))}
+	for i, entry := range entries {
+		resp.Orders[i] = cachedOrder{OrderUID: entry.Key, AccessedAt: entry.AccessedAt, ExpiresAt: entry.ExpiresAt}
+	}
+
+	writeJSON(w, r, log, http.StatusOK, resp)
+}
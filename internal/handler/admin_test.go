@@ -0,0 +1,146 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webtechl0/internal/cache"
+	"webtechl0/internal/handler"
+	"webtechl0/internal/models"
+)
+
+const testAdminToken = "secret"
+
+type fakeAdminService struct {
+	cached     map[string]bool
+	rewarmErr  error
+	rewarmCtx  context.Context
+	purgeCalls int
+}
+
+func (s *fakeAdminService) InvalidateOrder(orderUID string) bool {
+	cached := s.cached[orderUID]
+	delete(s.cached, orderUID)
+	return cached
+}
+
+func (s *fakeAdminService) PurgeCache() int {
+	s.purgeCalls++
+	purged := len(s.cached)
+	clear(s.cached)
+	return purged
+}
+
+func (s *fakeAdminService) RewarmCache(ctx context.Context) error {
+	s.rewarmCtx = ctx
+	return s.rewarmErr
+}
+
+func (s *fakeAdminService) CachedOrders() []cache.EntryInfo[string] {
+	var entries []cache.EntryInfo[string]
+	for uid := range s.cached {
+		entries = append(entries, cache.EntryInfo[string]{Key: uid, AccessedAt: time.Now()})
+	}
+	return entries
+}
+
+func newAdminRouter(ctx context.Context, adminService handler.AdminService) http.Handler {
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	adminHandler := handler.NewAdminHandler(ctx, adminService, testAdminToken, lg)
+	return handler.NewRouter(handler.NewOrderHandler(&fakeOrderService{}, nil, lg), handler.NewHealthHandler(nil, lg), adminHandler, lg)
+}
+
+func adminRequest(router http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	svc := &fakeAdminService{cached: map[string]bool{"a": true}}
+	router := newAdminRouter(context.Background(), svc)
+
+	for _, token := range []string{"", "wrong"} {
+		rec := adminRequest(router, http.MethodDelete, "/admin/cache", token)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" || errorCode(t, rec) != handler.CodeUnauthorized {
+			t.Errorf("token %q: expected 401 with a challenge, got %d %s", token, rec.Code, rec.Body.String())
+		}
+	}
+	if svc.purgeCalls != 0 {
+		t.Errorf("expected unauthorized requests not to reach the service")
+	}
+
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router = handler.NewRouter(handler.NewOrderHandler(&fakeOrderService{}, nil, lg), handler.NewHealthHandler(nil, lg), nil, lg)
+	if rec := adminRequest(router, http.MethodDelete, "/admin/cache", testAdminToken); rec.Code != http.StatusNotFound {
+		t.Errorf("expected no admin endpoints without an admin handler, got %d", rec.Code)
+	}
+}
+
+func TestAdminCacheEndpoints(t *testing.T) {
+	svc := &fakeAdminService{cached: map[string]bool{"a": true, "b": true}}
+	router := newAdminRouter(context.Background(), svc)
+
+	rec := adminRequest(router, http.MethodGet, "/admin/cache/orders", testAdminToken)
+	var list struct {
+		Count  int `json:"count"`
+		Orders []struct {
+			OrderUID string `json:"order_uid"`
+		} `json:"orders"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK || list.Count != 2 || len(list.Orders) != 2 {
+		t.Errorf("expected 2 cached orders, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, want := range []bool{true, false} {
+		rec := adminRequest(router, http.MethodDelete, "/admin/cache/orders/a", testAdminToken)
+		var resp struct {
+			OrderUID string `json:"order_uid"`
+			Evicted  bool   `json:"evicted"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.OrderUID != "a" || resp.Evicted != want {
+			t.Errorf("expected evicted %v, got %d %s", want, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = adminRequest(router, http.MethodDelete, "/admin/cache", testAdminToken)
+	var purge struct {
+		Purged int `json:"purged"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &purge); err != nil || rec.Code != http.StatusOK || purge.Purged != 1 {
+		t.Errorf("expected 1 order purged, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminRewarmCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := &fakeAdminService{}
+	router := newAdminRouter(ctx, svc)
+
+	if rec := adminRequest(router, http.MethodPost, "/admin/cache/warmup", testAdminToken); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d %s", rec.Code, rec.Body.String())
+	}
+	if svc.rewarmCtx.Err() != nil {
+		t.Errorf("expected the re-warm to outlive the request")
+	}
+	cancel()
+	if svc.rewarmCtx.Err() == nil {
+		t.Errorf("expected the re-warm to be cancelled with the handler's context")
+	}
+
+	svc.rewarmErr = models.ErrWarmupInProgress
+	if rec := adminRequest(router, http.MethodPost, "/admin/cache/warmup", testAdminToken); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 while a warm-up is running, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"webtechl0/internal/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "webtechl0/internal/handler"
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients, longer ones are replaced.
+const maxRequestIDLength = 128
+
+// contextMiddleware puts the request ID and a server span into the request context, so that
+// they end up in every log record written while serving the request. The X-Request-ID of the
+// request is kept or a new one is generated, and echoed in the response. A traceparent header
+// makes the span a child of the caller's span. loggingMiddleware names the span after the
+// matched route once it is known.
+func contextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = logging.NewRequestID()
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)),
+		)
+		defer span.End()
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(ctx, id)))
+	})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"webtechl0/internal/logging"
+	"webtechl0/internal/models"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Error codes returned in the error envelope. Clients should branch on these, not on messages.
+const (
+	CodeInvalidArgument      = "invalid_argument"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeValidationFailed     = "validation_failed"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeUnauthorized         = "unauthorized"
+	CodeNotFound             = "not_found"
+	CodeAlreadyExists        = "already_exists"
+	CodeConflict             = "conflict"
+	CodeRequestInProgress    = "request_in_progress"
+	CodeWarmupInProgress     = "warmup_in_progress"
+	CodeCanceled             = "canceled"
+	CodeUnavailable          = "unavailable"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal"
+)
+
+var (
+	errInvalidBody          = errors.New("invalid request body")
+	errIdempotencyKeyReused = errors.New("idempotency key was already used with a different request body")
+	errRequestInProgress    = errors.New("a request with this idempotency key is still in progress")
+)
+
+// statusClientClosedRequest is the nginx status for requests the client gave up on.
+const statusClientClosedRequest = 499
+
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	Details   any    `json:"details,omitempty"`
+}
+
+type paramDetails struct {
+	Param string `json:"param"`
+	Value string `json:"value"`
+}
+
+type fieldDetails struct {
+	Field string `json:"field"`
+	Tag   string `json:"tag"`
+	Param string `json:"param,omitempty"`
+}
+
+// errorStatus maps an error to its status code, error code and details. Internal errors get
+// a generic message, so that nothing about the storage leaks to clients.
+func errorStatus(err error) (int, ErrorBody) {
+	var paramErr *models.InvalidParamError
+	var fieldErrs validator.ValidationErrors
+	var maxBytesErr *http.MaxBytesError
+	var timeoutErr interface{ Timeout() bool }
+
+	switch {
+	case errors.As(err, &paramErr):
+		return http.StatusBadRequest, ErrorBody{
+			Code:    CodeInvalidArgument,
+			Message: paramErr.Error(),
+			Details: paramDetails{Param: paramErr.Param, Value: paramErr.Value},
+		}
+	case errors.Is(err, models.ErrInvalidCursor), errors.Is(err, errInvalidBody):
+		return http.StatusBadRequest, ErrorBody{Code: CodeInvalidArgument, Message: err.Error()}
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, ErrorBody{Code: CodePayloadTooLarge, Message: fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit)}
+	case errors.As(err, &fieldErrs):
+		details := make([]fieldDetails, 0, len(fieldErrs))
+		for _, fe := range fieldErrs {
+			details = append(details, fieldDetails{Field: fe.Namespace(), Tag: fe.Tag(), Param: fe.Param()})
+		}
+		return http.StatusUnprocessableEntity, ErrorBody{Code: CodeValidationFailed, Message: "Validation failed", Details: details}
+	case errors.Is(err, errIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity, ErrorBody{Code: CodeIdempotencyKeyReused, Message: err.Error()}
+	case errors.Is(err, models.ErrOrderNotFound):
+		return http.StatusNotFound, ErrorBody{Code: CodeNotFound, Message: "Order not found"}
+	case errors.Is(err, models.ErrOrderExists):
+		return http.StatusConflict, ErrorBody{Code: CodeAlreadyExists, Message: err.Error()}
+	case errors.Is(err, models.ErrOrderConflict):
+		return http.StatusConflict, ErrorBody{Code: CodeConflict, Message: err.Error()}
+	case errors.Is(err, errRequestInProgress):
+		return http.StatusConflict, ErrorBody{Code: CodeRequestInProgress, Message: err.Error()}
+	case errors.Is(err, models.ErrWarmupInProgress):
+		return http.StatusConflict, ErrorBody{Code: CodeWarmupInProgress, Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, ErrorBody{Code: CodeCanceled, Message: "Request canceled"}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		return http.StatusGatewayTimeout, ErrorBody{Code: CodeTimeout, Message: "Request timed out"}
+	case errors.Is(err, models.ErrTransient):
+		return http.StatusServiceUnavailable, ErrorBody{Code: CodeUnavailable, Message: "Service temporarily unavailable"}
+	default:
+		return http.StatusInternalServerError, ErrorBody{Code: CodeInternal, Message: "Internal server error"}
+	}
+}
+
+// writeError responds with the error envelope for err. Server errors are logged at error
+// level, client errors at info level.
+func writeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	status, body := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		log.ErrorContext(r.Context(), "Request failed", slog.Int("status", status), slog.Any("error", err))
+	} else {
+		log.InfoContext(r.Context(), "Request rejected", slog.Int("status", status), slog.Any("error", err))
+	}
+
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeErrorBody(w, r, log, status, body)
+}
+
+func writeErrorBody(w http.ResponseWriter, r *http.Request, log *slog.Logger, status int, body ErrorBody) {
+	body.RequestID = logging.RequestID(r.Context())
+	writeJSON(w, r, log, status, ErrorResponse{Error: body})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, log *slog.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.ErrorContext(r.Context(), "Failed to encode response", slog.Any("error", err))
+	}
+}
@@ -3,25 +3,40 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"webtechl0/internal/models"
 )
 
+// maxOrderBodySize bounds the body of POST /orders.
+const maxOrderBodySize = 1 << 20
+
 type OrderService interface {
 	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
-	GetOrders(ctx context.Context) ([]*models.Order, error)
+	GetOrders(ctx context.Context, query models.OrdersQuery) (*models.OrdersPage, error)
+	CreateOrder(ctx context.Context, order *models.Order) error
 }
 
 type OrderHandler struct {
 	orderService OrderService
+	idempotency  *idempotency
 	lg           *slog.Logger
 }
 
-func NewOrderHandler(orderService OrderService, lg *slog.Logger) *OrderHandler {
-	return &OrderHandler{orderService: orderService, lg: lg}
+// NewOrderHandler creates the order handler. Responses to POST /orders are saved in
+// idempotencyStore under the Idempotency-Key header, if it is nil the header is ignored.
+func NewOrderHandler(orderService OrderService, idempotencyStore IdempotencyStore, lg *slog.Logger) *OrderHandler {
+	h := &OrderHandler{orderService: orderService, lg: lg}
+	if idempotencyStore != nil {
+		h.idempotency = newIdempotency(idempotencyStore)
+	}
+	return h
 }
 
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
@@ -30,41 +45,157 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	log := h.lg.With(slog.String("op", op), slog.String("order_uid", orderUID))
 
 	order, err := h.orderService.GetOrder(r.Context(), orderUID)
-
 	if err != nil {
-		if errors.Is(err, models.ErrOrderNotFound) {
-			log.Info("Order not found")
-			http.Error(w, "Order not found", http.StatusNotFound)
-			return
-		}
-
-		log.Error("Internal server error", slog.Any("error", err))
-		http.Error(w, "Internal server error", http.StatusBadRequest)
+		writeError(w, r, log, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(order); err != nil {
-		log.Error("Failed to encode response", slog.Any("error", err))
-	}
+	writeJSON(w, r, log, http.StatusOK, order)
 }
 
 func (h *OrderHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
 	op := "OrderHandler.GetAllOrders"
 	log := h.lg.With(slog.String("op", op))
 
-	orders, err := h.orderService.GetOrders(r.Context())
+	query, err := parseOrdersQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, log, err)
+		return
+	}
+
+	page, err := h.orderService.GetOrders(r.Context(), query)
+	if err != nil {
+		writeError(w, r, log, err)
+		return
+	}
+
+	writeJSON(w, r, log, http.StatusOK, page)
+}
+
+// CreateOrder accepts the same order JSON as the Kafka consumer. A request with an
+// Idempotency-Key header that was already handled gets the saved response back.
+func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	op := "OrderHandler.CreateOrder"
+	log := h.lg.With(slog.String("op", op))
 
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBodySize))
 	if err != nil {
-		log.Error("Internal server error", slog.Any("error", err))
-		http.Error(w, "Internal server error", http.StatusBadRequest)
+		writeError(w, r, log, fmt.Errorf("failed to read request body: %w", err))
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || h.idempotency == nil {
+		h.createOrder(w, r, log, body)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, r, log, &models.InvalidParamError{Param: "Idempotency-Key", Value: key, Reason: "must be at most 255 characters"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(orders); err != nil {
-		log.Error("Failed to encode response", slog.Any("error", err))
+	log = log.With(slog.String("idempotency_key", key))
+	bodyHash := hashBody(body)
+	saved, err := h.idempotency.begin(key, bodyHash)
+	if err != nil {
+		writeError(w, r, log, err)
+		return
 	}
+	if saved != nil {
+		log.InfoContext(r.Context(), "Replaying saved response", slog.Int("status", saved.Status))
+		saved.replay(w)
+		return
+	}
+
+	rec := &recordingResponseWriter{ResponseWriter: w}
+	returned := false
+	defer func() {
+		resp := IdempotentResponse{BodyHash: bodyHash, Location: rec.Header().Get("Location"), Body: rec.body.Bytes()}
+		// A handler that panicked has no complete response to replay, the key is only released.
+		if returned {
+			resp.Status = rec.statusCode
+		}
+		h.idempotency.end(key, resp)
+	}()
+	h.createOrder(rec, r, log, body)
+	returned = true
+}
+
+func (h *OrderHandler) createOrder(w http.ResponseWriter, r *http.Request, log *slog.Logger, body []byte) {
+	var order models.Order
+	if err := json.Unmarshal(body, &order); err != nil {
+		writeError(w, r, log, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	log = log.With(slog.String("order_uid", order.OrderUID))
+	if err := models.ValidateOrder(&order); err != nil {
+		writeError(w, r, log, err)
+		return
+	}
+
+	if err := h.orderService.CreateOrder(r.Context(), &order); err != nil {
+		writeError(w, r, log, err)
+		return
+	}
+
+	log.InfoContext(r.Context(), "Created order")
+	w.Header().Set("Location", "/order/"+url.PathEscape(order.OrderUID)+"/")
+	writeJSON(w, r, log, http.StatusCreated, &order)
+}
+
+// parseOrdersQuery reads pagination, filter and sort parameters of GET /orders/.
+func parseOrdersQuery(values url.Values) (models.OrdersQuery, error) {
+	query := models.OrdersQuery{
+		Filter: models.OrderFilter{
+			CustomerID:      values.Get("customer_id"),
+			DeliveryService: values.Get("delivery_service"),
+			Locale:          values.Get("locale"),
+			Currency:        values.Get("currency"),
+		},
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return query, &models.InvalidParamError{Param: "limit", Value: v, Reason: "must be a positive integer"}
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := models.DecodeOrderCursor(v)
+		if err != nil {
+			return query, &models.InvalidParamError{Param: "cursor", Value: v, Reason: "must be a next_cursor value"}
+		}
+		query.After = cursor
+	}
+
+	for _, date := range []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"date_from", &query.Filter.CreatedFrom},
+		{"date_to", &query.Filter.CreatedTo},
+	} {
+		if v := values.Get(date.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, &models.InvalidParamError{Param: date.param, Value: v, Reason: "must be an RFC 3339 timestamp"}
+			}
+			// date_created is compared without a zone, so bounds are taken in UTC.
+			*date.dst = t.UTC()
+		}
+	}
+
+	switch sort := values.Get("sort"); sort {
+	case "", "-date_created":
+	case "date_created":
+		query.Ascending = true
+	default:
+		return query, &models.InvalidParamError{Param: "sort", Value: sort, Reason: "must be date_created or -date_created"}
+	}
+
+	return query, nil
 }
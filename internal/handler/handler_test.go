@@ -0,0 +1,409 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"webtechl0/internal/cache"
+	"webtechl0/internal/handler"
+	"webtechl0/internal/models"
+	"webtechl0/internal/testutil"
+)
+
+type fakeOrderService struct {
+	err error
+	// query is the last query passed to GetOrders.
+	query models.OrdersQuery
+
+	mu      sync.Mutex
+	created map[string]bool
+	creates int
+	// block, if set, holds CreateOrder until it is closed, after a send on started.
+	block   chan struct{}
+	started chan struct{}
+	// panics makes the next CreateOrder panic.
+	panics bool
+}
+
+func (s *fakeOrderService) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Order{OrderUID: orderUID}, nil
+}
+
+func (s *fakeOrderService) GetOrders(ctx context.Context, query models.OrdersQuery) (*models.OrdersPage, error) {
+	s.query = query
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.OrdersPage{}, nil
+}
+
+func (s *fakeOrderService) CreateOrder(ctx context.Context, order *models.Order) error {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	if s.panics {
+		s.panics = false
+		panic("create order")
+	}
+	if s.err != nil {
+		return s.err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created[order.OrderUID] {
+		return fmt.Errorf("%w: %s", models.ErrOrderExists, order.OrderUID)
+	}
+	if s.created == nil {
+		s.created = make(map[string]bool)
+	}
+	s.created[order.OrderUID] = true
+	s.creates++
+	return nil
+}
+
+func newTestRouter(orderService handler.OrderService) http.Handler {
+	return newTestRouterWithStore(orderService, nil)
+}
+
+func newTestRouterWithStore(orderService handler.OrderService, store handler.IdempotencyStore) http.Handler {
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return handler.NewRouter(handler.NewOrderHandler(orderService, store, lg), handler.NewHealthHandler(nil, lg), nil, lg)
+}
+
+func postOrder(router http.Handler, body []byte, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var resp handler.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode error response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Error.Code
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", "/order/b563/", fmt.Errorf("failed to get order: %w", models.ErrOrderNotFound), http.StatusNotFound, handler.CodeNotFound},
+		{"internal", "/order/b563/", errors.New("connection reset"), http.StatusInternalServerError, handler.CodeInternal},
+		{"transient", "/order/b563/", fmt.Errorf("%w: too many connections", models.ErrTransient), http.StatusServiceUnavailable, handler.CodeUnavailable},
+		{"timeout", "/order/b563/", fmt.Errorf("failed to get order: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, handler.CodeTimeout},
+		{"canceled", "/order/b563/", context.Canceled, 499, handler.CodeCanceled},
+		{"invalid cursor", "/orders/", fmt.Errorf("%w: wrong sort", models.ErrInvalidCursor), http.StatusBadRequest, handler.CodeInvalidArgument},
+		{"invalid param", "/orders/?limit=-1", nil, http.StatusBadRequest, handler.CodeInvalidArgument},
+		{"internal list", "/orders/", errors.New("connection reset"), http.StatusInternalServerError, handler.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(&fakeOrderService{err: tt.err})
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected JSON content type, got %q", ct)
+			}
+
+			var resp handler.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode error response %q: %v", rec.Body.String(), err)
+			}
+			if resp.Error.Code != tt.code || resp.Error.Message == "" || resp.Error.RequestID != "req-1" {
+				t.Errorf("unexpected error body %+v", resp.Error)
+			}
+		})
+	}
+}
+
+func TestErrorResponseHidesInternalErrors(t *testing.T) {
+	router := newTestRouter(&fakeOrderService{err: errors.New("password authentication failed for user postgres")})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/b563/", nil))
+
+	var resp handler.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if resp.Error.Message != "Internal server error" {
+		t.Errorf("expected a generic message, got %q", resp.Error.Message)
+	}
+	if resp.Error.RequestID == "" || resp.Error.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Errorf("expected the generated request ID in the body and header, got %q and %q",
+			resp.Error.RequestID, rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestInvalidParamDetails(t *testing.T) {
+	router := newTestRouter(&fakeOrderService{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/?sort=price", nil))
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Param string `json:"param"`
+				Value string `json:"value"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest || resp.Error.Details.Param != "sort" || resp.Error.Details.Value != "price" {
+		t.Errorf("expected 400 with the sort parameter in details, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestParseOrdersQuery(t *testing.T) {
+	cursor := models.OrderCursor{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OrderUID: "b563"}
+
+	tests := []struct {
+		name  string
+		query string
+		param string
+		want  models.OrdersQuery
+	}{
+		{name: "defaults", query: "", want: models.OrdersQuery{}},
+		{
+			name:  "filters",
+			query: "customer_id=test&delivery_service=meest&locale=en&currency=USD&limit=5&sort=date_created",
+			want: models.OrdersQuery{
+				Filter:    models.OrderFilter{CustomerID: "test", DeliveryService: "meest", Locale: "en", Currency: "USD"},
+				Limit:     5,
+				Ascending: true,
+			},
+		},
+		{
+			name:  "dates in UTC",
+			query: "date_from=2021-11-26T09:22:19%2B03:00&date_to=2021-11-27T00:00:00Z",
+			want: models.OrdersQuery{Filter: models.OrderFilter{
+				CreatedFrom: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+				CreatedTo:   time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC),
+			}},
+		},
+		{name: "cursor", query: "cursor=" + cursor.Encode(), want: models.OrdersQuery{After: &cursor}},
+		{name: "zero limit", query: "limit=0", param: "limit"},
+		{name: "text limit", query: "limit=ten", param: "limit"},
+		{name: "bad cursor", query: "cursor=!", param: "cursor"},
+		{name: "bad date", query: "date_from=2021-11-26", param: "date_from"},
+		{name: "both dates bad", query: "date_to=tomorrow&date_from=today", param: "date_from"},
+		{name: "bad sort", query: "sort=price", param: "sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeOrderService{}
+			rec := httptest.NewRecorder()
+			newTestRouter(svc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/?"+tt.query, nil))
+
+			if tt.param != "" {
+				if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"param":"`+tt.param+`"`) {
+					t.Errorf("expected 400 for %s, got %d %s", tt.param, rec.Code, rec.Body.String())
+				}
+				return
+			}
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+			}
+			got := svc.query
+			if got.Filter != tt.want.Filter || got.Limit != tt.want.Limit || got.Ascending != tt.want.Ascending {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			if got.Filter.CreatedFrom.Location() != time.UTC {
+				t.Errorf("expected date_from in UTC, got %v", got.Filter.CreatedFrom)
+			}
+			if (got.After == nil) != (tt.want.After == nil) || got.After != nil && *got.After != *tt.want.After {
+				t.Errorf("expected cursor %+v, got %+v", tt.want.After, got.After)
+			}
+		})
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	router := newTestRouter(&fakeOrderService{})
+
+	rec := postOrder(router, testutil.OrderJSON(t, "b563"), "")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/order/b563/" {
+		t.Fatalf("expected 201 with the order location, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = postOrder(router, testutil.OrderJSON(t, "b563"), "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != handler.CodeAlreadyExists {
+		t.Errorf("expected 409 for a duplicate, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = postOrder(router, []byte(`{"order_uid": `), "")
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != handler.CodeInvalidArgument {
+		t.Errorf("expected 400 for invalid JSON, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateOrderValidationDetails(t *testing.T) {
+	router := newTestRouter(&fakeOrderService{})
+
+	var order models.Order
+	if err := json.Unmarshal(testutil.OrderJSON(t, "b563"), &order); err != nil {
+		t.Fatalf("failed to decode order: %v", err)
+	}
+	order.Delivery.Phone = "not a phone"
+	order.TrackNumber = ""
+	body, _ := json.Marshal(order)
+
+	rec := postOrder(router, body, "")
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details []struct {
+				Field string `json:"field"`
+				Tag   string `json:"tag"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if rec.Code != http.StatusUnprocessableEntity || resp.Error.Code != handler.CodeValidationFailed {
+		t.Fatalf("expected 422, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	fields := make(map[string]string)
+	for _, d := range resp.Error.Details {
+		fields[d.Field] = d.Tag
+	}
+	if fields["Order.TrackNumber"] != "required" || fields["Order.Delivery.Phone"] != "e164" || len(fields) != 2 {
+		t.Errorf("expected both invalid fields in details, got %+v", resp.Error.Details)
+	}
+}
+
+func TestCreateOrderIdempotencyKey(t *testing.T) {
+	orderService := &fakeOrderService{}
+	router := newTestRouterWithStore(orderService, cache.NewLRUCache[string, handler.IdempotentResponse](10))
+
+	body := testutil.OrderJSON(t, "b563")
+	first := postOrder(router, body, "key-1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", first.Code, first.Body.String())
+	}
+
+	replay := postOrder(router, body, "key-1")
+	if replay.Code != http.StatusCreated || replay.Header().Get("Idempotent-Replayed") != "true" ||
+		replay.Header().Get("Location") != "/order/b563/" || replay.Body.String() != first.Body.String() {
+		t.Errorf("expected the saved response to be replayed, got %d %s", replay.Code, replay.Body.String())
+	}
+	if orderService.creates != 1 {
+		t.Errorf("expected the order to be created once, got %d", orderService.creates)
+	}
+
+	rec := postOrder(router, testutil.OrderJSON(t, "c674"), "key-1")
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != handler.CodeIdempotencyKeyReused {
+		t.Errorf("expected 422 for a reused key, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = postOrder(router, body, "key-2")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != handler.CodeAlreadyExists {
+		t.Errorf("expected 409 for a duplicate under a new key, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateOrderIdempotencyMaxWeight(t *testing.T) {
+	const maxWeight = 4096
+	store := cache.NewLRUCache(100, cache.WithMaxWeight(maxWeight, handler.IdempotentResponseWeigher))
+	router := newTestRouterWithStore(&fakeOrderService{}, store)
+
+	for i := range 10 {
+		uid := fmt.Sprintf("order-%d", i)
+		if rec := postOrder(router, testutil.OrderJSON(t, uid), uid); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	s := store.Stats()
+	if s.Weight > maxWeight || s.Size == 0 || s.Size == 10 {
+		t.Errorf("expected the oldest responses dropped to fit %d bytes, got %+v", maxWeight, s)
+	}
+	if _, ok := store.Get("order-9"); !ok {
+		t.Errorf("expected the latest response to be kept")
+	}
+}
+
+func TestCreateOrderIdempotencyKeyAfterPanic(t *testing.T) {
+	orderService := &fakeOrderService{panics: true}
+	store := cache.NewLRUCache[string, handler.IdempotentResponse](10)
+	router := newTestRouterWithStore(orderService, store)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the handler to panic")
+			}
+		}()
+		postOrder(router, testutil.OrderJSON(t, "b563"), "key-1")
+	}()
+	if store.Len() != 0 {
+		t.Errorf("expected no response saved after a panic")
+	}
+
+	if rec := postOrder(router, testutil.OrderJSON(t, "b563"), "key-1"); rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected the retry to be handled, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateOrderIdempotencyKeyInProgress(t *testing.T) {
+	orderService := &fakeOrderService{block: make(chan struct{}), started: make(chan struct{})}
+	router := newTestRouterWithStore(orderService, cache.NewLRUCache[string, handler.IdempotentResponse](10))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postOrder(router, testutil.OrderJSON(t, "b563"), "key-1") }()
+	<-orderService.started
+
+	rec := postOrder(router, testutil.OrderJSON(t, "b563"), "key-1")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != handler.CodeRequestInProgress {
+		t.Errorf("expected 409 while the first request is in progress, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	close(orderService.block)
+	if rec := <-done; rec.Code != http.StatusCreated {
+		t.Errorf("expected the first request to succeed, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webtechl0/internal/service"
+)
+
+// healthCheckTimeout bounds every readiness check, so a hung dependency cannot hang /readyz.
+const healthCheckTimeout = 2 * time.Second
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// HealthCheck is a dependency checked by /readyz. Check returns an error when the dependency
+// is not ready, along with details to report either way, such as the consumer lag.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) (any, error)
+}
+
+type WarmupReporter interface {
+	WarmupStatus() service.WarmupStatus
+}
+
+var errWarmupNotFinished = errors.New("cache warm-up has not finished")
+
+// WarmupCheck reports ready once the first cache warm-up has finished. A failed warm-up does
+// not keep the service from serving, orders are then loaded from the DB on demand, and
+// neither does a re-warm requested later.
+func WarmupCheck(warmup WarmupReporter) HealthCheck {
+	return HealthCheck{Name: "cache", Check: func(ctx context.Context) (any, error) {
+		status := warmup.WarmupStatus()
+		if !status.Warmed {
+			return status, errWarmupNotFinished
+		}
+		return status, nil
+	}}
+}
+
+type HealthHandler struct {
+	checks       []HealthCheck
+	shuttingDown atomic.Bool
+	lg           *slog.Logger
+}
+
+func NewHealthHandler(checks []HealthCheck, lg *slog.Logger) *HealthHandler {
+	return &HealthHandler{checks: checks, lg: lg}
+}
+
+// Shutdown makes /readyz report not ready from now on, so that traffic drains before the
+// server stops.
+func (h *HealthHandler) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+type livenessResponse struct {
+	Status string `json:"status"`
+}
+
+// Live reports that the process is up and serving HTTP. It checks no dependencies: restarting
+// the service would not fix them.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.lg.With(slog.String("op", "HealthHandler.Live")), http.StatusOK, livenessResponse{Status: StatusOK})
+}
+
+type componentStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+	Details  any    `json:"details,omitempty"`
+}
+
+type readinessResponse struct {
+	Ready        bool                       `json:"ready"`
+	ShuttingDown bool                       `json:"shutting_down,omitempty"`
+	Components   map[string]componentStatus `json:"components"`
+}
+
+// Ready runs all checks concurrently and responds with 200 if every one passed, otherwise 503.
+// It always responds with 503 once Shutdown has been called.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	op := "HealthHandler.Ready"
+	log := h.lg.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	resp := readinessResponse{Ready: true, Components: make(map[string]componentStatus, len(h.checks))}
+	statuses := make([]componentStatus, len(h.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range h.checks {
+		resp.Components[check.Name] = statuses[i]
+		if statuses[i].Status != StatusOK {
+			resp.Ready = false
+			log.DebugContext(r.Context(), "Component not ready", slog.String("component", check.Name), slog.String("error", statuses[i].Error))
+		}
+	}
+
+	if h.shuttingDown.Load() {
+		resp.Ready = false
+		resp.ShuttingDown = true
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, log, status, resp)
+}
+
+func runCheck(ctx context.Context, check HealthCheck) componentStatus {
+	start := time.Now()
+	details, err := check.Check(ctx)
+
+	status := componentStatus{Status: StatusOK, Duration: time.Since(start).String(), Details: details}
+	if err != nil {
+		status.Status = StatusFail
+		status.Error = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webtechl0/internal/handler"
+	"webtechl0/internal/service"
+)
+
+type fakeWarmup struct {
+	warmed bool
+}
+
+func (w fakeWarmup) WarmupStatus() service.WarmupStatus {
+	return service.WarmupStatus{Warmed: w.warmed}
+}
+
+type readiness struct {
+	Ready        bool `json:"ready"`
+	ShuttingDown bool `json:"shutting_down"`
+	Components   map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"components"`
+}
+
+func checkReady(t *testing.T, h *handler.HealthHandler) (int, readiness) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var resp readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode readiness response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealthHandlerReady(t *testing.T) {
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pingErr := errors.New("connection refused")
+	ok := func(ctx context.Context) (any, error) { return nil, nil }
+
+	h := handler.NewHealthHandler([]handler.HealthCheck{
+		{Name: "postgres", Check: ok},
+		{Name: "kafka", Check: ok},
+		handler.WarmupCheck(fakeWarmup{warmed: true}),
+	}, lg)
+	if code, resp := checkReady(t, h); code != http.StatusOK || !resp.Ready || len(resp.Components) != 3 {
+		t.Errorf("expected ready with 3 components, got %d %+v", code, resp)
+	}
+
+	h = handler.NewHealthHandler([]handler.HealthCheck{
+		{Name: "postgres", Check: func(ctx context.Context) (any, error) { return nil, pingErr }},
+		{Name: "kafka", Check: ok},
+		handler.WarmupCheck(fakeWarmup{}),
+	}, lg)
+	code, resp := checkReady(t, h)
+	if code != http.StatusServiceUnavailable || resp.Ready {
+		t.Errorf("expected not ready, got %d %+v", code, resp)
+	}
+	if c := resp.Components["postgres"]; c.Status != handler.StatusFail || c.Error != pingErr.Error() {
+		t.Errorf("expected postgres to fail with its error, got %+v", c)
+	}
+	if c := resp.Components["kafka"]; c.Status != handler.StatusOK {
+		t.Errorf("expected kafka to be ok, got %+v", c)
+	}
+	if c := resp.Components["cache"]; c.Status != handler.StatusFail {
+		t.Errorf("expected cache to fail before warm-up, got %+v", c)
+	}
+}
+
+func TestHealthHandlerShutdown(t *testing.T) {
+	h := handler.NewHealthHandler(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if code, _ := checkReady(t, h); code != http.StatusOK {
+		t.Fatalf("expected ready without checks, got %d", code)
+	}
+
+	h.Shutdown()
+	if code, resp := checkReady(t, h); code != http.StatusServiceUnavailable || !resp.ShuttingDown {
+		t.Errorf("expected not ready while shutting down, got %d %+v", code, resp)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Live(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected live while shutting down, got %d", rec.Code)
+	}
+}
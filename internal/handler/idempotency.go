@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+)
+
+// maxIdempotencyKeyLength bounds the keys kept in memory.
+const maxIdempotencyKeyLength = 255
+
+// IdempotentResponse is a response saved under an idempotency key, along with the hash of
+// the request body it was the response to.
+type IdempotentResponse struct {
+	BodyHash string
+	Status   int
+	Location string
+	Body     []byte
+}
+
+// idempotentResponseOverhead approximates the memory a saved response takes besides its
+// strings and body: the struct, the cache entry and the map bucket.
+const idempotentResponseOverhead = 192
+
+// IdempotentResponseWeigher estimates the memory used by a saved response in bytes. It is
+// meant for cache.WithMaxWeight, so that large bodies cannot exhaust memory.
+func IdempotentResponseWeigher(key string, resp IdempotentResponse) int64 {
+	return int64(idempotentResponseOverhead + len(key) + len(resp.BodyHash) + len(resp.Location) + len(resp.Body))
+}
+
+type IdempotencyStore interface {
+	Get(key string) (IdempotentResponse, bool)
+	Put(key string, resp IdempotentResponse)
+}
+
+// idempotency replays saved responses to repeated requests and rejects requests that reuse
+// a key while the first one is still being handled.
+type idempotency struct {
+	store IdempotencyStore
+
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+func newIdempotency(store IdempotencyStore) *idempotency {
+	return &idempotency{store: store, inFlight: make(map[string]struct{})}
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// begin returns the saved response for the key, if any. Otherwise it marks the key as in
+// flight until end is called.
+func (i *idempotency) begin(key, bodyHash string) (*IdempotentResponse, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if resp, ok := i.store.Get(key); ok {
+		if resp.BodyHash != bodyHash {
+			return nil, errIdempotencyKeyReused
+		}
+		return &resp, nil
+	}
+
+	if _, ok := i.inFlight[key]; ok {
+		return nil, errRequestInProgress
+	}
+	i.inFlight[key] = struct{}{}
+	return nil, nil
+}
+
+// end saves the response under the key and releases it. Responses that may differ on retry,
+// such as server errors and canceled requests, are not saved, so the request can be retried
+// with the same key. Neither is a response without a status, one that was never written.
+func (i *idempotency) end(key string, resp IdempotentResponse) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if resp.Status != 0 && resp.Status < statusClientClosedRequest {
+		i.store.Put(key, resp)
+	}
+	delete(i.inFlight, key)
+}
+
+// replay writes the saved response and marks it as replayed.
+func (resp *IdempotentResponse) replay(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	if resp.Location != "" {
+		w.Header().Set("Location", resp.Location)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// recordingResponseWriter keeps a copy of the response, so it can be saved for replays. The
+// status stays zero until the response is written.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *recordingResponseWriter) WriteHeader(code int) {
+	if r.statusCode == 0 {
+		r.statusCode = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recordingResponseWriter) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
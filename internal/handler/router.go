@@ -3,18 +3,40 @@ package handler
 import (
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"webtechl0/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func NewRouter(orderHandler *OrderHandler, log *slog.Logger) http.Handler {
+// NewRouter registers the admin endpoints only when adminHandler is not nil.
+func NewRouter(orderHandler *OrderHandler, healthHandler *HealthHandler, adminHandler *AdminHandler, log *slog.Logger) http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/", http.FileServer(http.Dir("./web")))
 
 	mux.HandleFunc("GET /order/{order_uid}/", orderHandler.GetOrder)
 	mux.HandleFunc("GET /orders/", orderHandler.GetAllOrders)
+	mux.HandleFunc("POST /orders", orderHandler.CreateOrder)
+
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", healthHandler.Live)
+	mux.HandleFunc("GET /readyz", healthHandler.Ready)
 
-	return loggingMiddleware(mux, log)
+	if adminHandler != nil {
+		mux.HandleFunc("GET /admin/cache/orders", adminHandler.Authorize(adminHandler.ListCachedOrders))
+		mux.HandleFunc("DELETE /admin/cache/orders/{order_uid}", adminHandler.Authorize(adminHandler.InvalidateOrder))
+		mux.HandleFunc("DELETE /admin/cache", adminHandler.Authorize(adminHandler.PurgeCache))
+		mux.HandleFunc("POST /admin/cache/warmup", adminHandler.Authorize(adminHandler.RewarmCache))
+	}
+
+	return contextMiddleware(loggingMiddleware(mux, log))
 }
 
 type loggingResponseWriter struct {
@@ -27,6 +49,25 @@ func (l *loggingResponseWriter) WriteHeader(code int) {
 	l.ResponseWriter.WriteHeader(code)
 }
 
+// endSpan names the server span after the route and records the status code. Only 5xx
+// responses mark the span as failed, client errors are not the server's failures.
+func endSpan(span trace.Span, r *http.Request, statusCode int) {
+	// Patterns may start with the method, the route attribute is the path part only.
+	route := r.Pattern
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	if route != "" {
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+	if statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
+
 func loggingMiddleware(next http.Handler, log *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -34,6 +75,17 @@ func loggingMiddleware(next http.Handler, log *slog.Logger) http.Handler {
 		l := loggingResponseWriter{w, http.StatusOK}
 		next.ServeHTTP(&l, r)
 
-		log.Info("Got request", slog.Any("method", r.Method), slog.Any("path", r.URL), slog.Any("status_code", l.statusCode), slog.Any("time", time.Since(start)))
+		elapsed := time.Since(start)
+
+		// The mux sets the matched pattern on the request, so it is known after serving.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(l.statusCode)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(elapsed.Seconds())
+		endSpan(trace.SpanFromContext(r.Context()), r, l.statusCode)
+
+		log.InfoContext(r.Context(), "Got request", slog.Any("method", r.Method), slog.Any("path", r.URL), slog.Any("status_code", l.statusCode), slog.Any("time", elapsed))
 	})
 }
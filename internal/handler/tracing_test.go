@@ -0,0 +1,120 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webtechl0/internal/cache"
+	"webtechl0/internal/models"
+	"webtechl0/internal/service"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedRepository serves a single order and records a span for each lookup, like the real
+// repository does.
+type tracedRepository struct {
+	service.OrderRepository
+	err error
+}
+
+func (r *tracedRepository) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	_, span := otel.Tracer("test").Start(ctx, "OrderRepository.GetOrder")
+	defer span.End()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &models.Order{OrderUID: orderUID}, nil
+}
+
+func setupTracing() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+}
+
+func eventNames(span tracetest.SpanStub) []string {
+	names := make([]string, len(span.Events))
+	for i, event := range span.Events {
+		names[i] = event.Name
+	}
+	return names
+}
+
+func TestRequestSpans(t *testing.T) {
+	exporter := setupTracing()
+
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	orderService := service.NewOrderService(&tracedRepository{}, cache.NewLRUCache[string, *models.Order](10), lg)
+	router := newTestRouter(orderService)
+
+	req := httptest.NewRequest(http.MethodGet, "/order/b563/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/b563/", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	load, first, second := spans[0], spans[1], spans[2]
+
+	if first.Name != "GET /order/{order_uid}/" || first.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected a server span named after the route, got %q", first.Name)
+	}
+	if first.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !first.Parent.IsRemote() {
+		t.Errorf("expected the first request to continue the caller's trace, got parent %v", first.Parent)
+	}
+	attrs := attribute.NewSet(first.Attributes...)
+	if route, _ := attrs.Value("http.route"); route.AsString() != "/order/{order_uid}/" {
+		t.Errorf("expected http.route attribute, got %q", route.AsString())
+	}
+	if status, _ := attrs.Value("http.response.status_code"); status.AsInt64() != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", status.AsInt64())
+	}
+
+	if load.Name != "OrderRepository.GetOrder" || load.Parent.SpanID() != first.SpanContext.SpanID() {
+		t.Errorf("expected the DB load to be a child of the first request, got %q with parent %v", load.Name, load.Parent)
+	}
+
+	if names := eventNames(first); len(names) != 1 || names[0] != "cache.miss" {
+		t.Errorf("expected a cache miss on the first request, got %v", names)
+	}
+	if names := eventNames(second); len(names) != 1 || names[0] != "cache.hit" {
+		t.Errorf("expected a cache hit on the second request, got %v", names)
+	}
+	if second.Parent.IsValid() {
+		t.Errorf("expected the second request to start a new trace, got parent %v", second.Parent)
+	}
+}
+
+func TestRequestSpanRecordsServerErrors(t *testing.T) {
+	exporter := setupTracing()
+
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repo := &tracedRepository{err: errors.New("connection reset")}
+	router := newTestRouter(service.NewOrderService(repo, cache.NewLRUCache[string, *models.Order](10), lg))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/b563/", nil))
+
+	spans := exporter.GetSpans()
+	server := spans[len(spans)-1]
+	if server.SpanKind != trace.SpanKindServer || server.Status.Code != codes.Error {
+		t.Errorf("expected the server span to fail, got %+v", server.Status)
+	}
+	if len(server.Events) == 0 || server.Events[len(server.Events)-1].Name != "exception" {
+		t.Errorf("expected the error to be recorded on the server span, got %v", eventNames(server))
+	}
+}
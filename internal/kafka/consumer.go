@@ -2,21 +2,63 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"webtechl0/internal/config"
+	"webtechl0/internal/metrics"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
 type Handler interface {
-	HandleMessage(ctx context.Context, data []byte) error
+	HandleMessage(ctx context.Context, msg kafka.Message) error
 }
 
+// BatchHandler is implemented by handlers that can process several messages at once.
+// The consumer uses it when batch mode is enabled in config.
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, msgs []kafka.Message) error
+}
+
+// MessageReader is the part of *kafka.Reader the consumer uses.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	// Stats is only used for the lag, the counters it resets are not reported elsewhere.
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+const workerQueueSize = 64
+
 type Consumer struct {
-	reader  *kafka.Reader
-	handler Handler
-	lg      *slog.Logger
+	reader       MessageReader
+	handler      Handler
+	batchHandler BatchHandler
+	retry        RetryPolicy
+	workers      int
+	batchSize    int
+	batchLinger  time.Duration
+	lg           *slog.Logger
+
+	brokers []string
+	maxLag  int64
+
+	pingMutex sync.Mutex
+	pingedAt  time.Time
+	pingErr   error
+
+	running atomic.Bool
+	// stalled is the number of workers retrying a message that has used up its retry attempts.
+	stalled atomic.Int32
 }
 
 func NewConsumer(cfg config.Kafka, handler Handler, lg *slog.Logger) *Consumer {
@@ -25,11 +67,75 @@ func NewConsumer(cfg config.Kafka, handler Handler, lg *slog.Logger) *Consumer {
 		Topic:   cfg.Topic,
 		GroupID: cfg.GroupID,
 	})
-	return &Consumer{reader: reader, handler: handler, lg: lg}
+	return NewConsumerWithReader(reader, cfg, handler, lg)
+}
+
+// NewConsumerWithReader creates a consumer reading from reader instead of the topic in cfg.
+func NewConsumerWithReader(reader MessageReader, cfg config.Kafka, handler Handler, lg *slog.Logger) *Consumer {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	c := &Consumer{
+		reader:      reader,
+		handler:     handler,
+		retry:       NewRetryPolicy(cfg),
+		workers:     workers,
+		batchSize:   cfg.BatchSize,
+		batchLinger: cfg.BatchLinger,
+		lg:          lg,
+		brokers:     cfg.Brokers,
+		maxLag:      cfg.HealthMaxLag,
+	}
+
+	if cfg.BatchSize > 1 {
+		if batchHandler, ok := handler.(BatchHandler); ok {
+			c.batchHandler = batchHandler
+		} else {
+			lg.Warn("Handler does not support batches, batch mode disabled")
+		}
+	}
+
+	return c
 }
 
+// Start fetches messages until ctx is cancelled and handles them on a pool of workers. All
+// messages of a partition go to the same worker, so they are committed in offset order. A
+// message or batch is committed only after it was handled, transient failures are retried
+// until they succeed and mark the consumer as stalled once the retry attempts are used up.
 func (c *Consumer) Start(ctx context.Context) error {
-	lg := c.lg.With(slog.String("op", "Consumer.Start"))
+	c.running.Store(true)
+	defer c.running.Store(false)
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	queues := make([]chan kafka.Message, c.workers)
+	for i := range queues {
+		queue := make(chan kafka.Message, workerQueueSize)
+		queues[i] = queue
+		g.Go(func() error {
+			if c.batchHandler != nil {
+				return c.workBatches(ctx, queue, c.batchHandler)
+			}
+			return c.work(ctx, queue)
+		})
+	}
+
+	g.Go(func() error {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		return c.fetch(ctx, queues)
+	})
+
+	return g.Wait()
+}
+
+func (c *Consumer) fetch(ctx context.Context, queues []chan kafka.Message) error {
+	lg := c.lg.With(slog.String("op", "Consumer.fetch"))
 
 	for {
 		msg, err := c.reader.FetchMessage(ctx)
@@ -44,15 +150,171 @@ func (c *Consumer) Start(ctx context.Context) error {
 			continue
 		}
 
+		metrics.KafkaFetched.Inc()
 		lg.Debug("Fetched message", slog.String("topic", msg.Topic), slog.Int64("offset", msg.Offset), slog.Int("partition", msg.Partition), slog.String("key", string(msg.Key)))
 
-		if err := c.handler.HandleMessage(ctx, msg.Value); err != nil {
-			lg.Error("Failed to handle message", slog.Any("error", err))
-			continue
+		select {
+		case queues[msg.Partition%len(queues)] <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Consumer) work(ctx context.Context, queue <-chan kafka.Message) error {
+	lg := c.lg.With(slog.String("op", "Consumer.work"))
+
+	for msg := range queue {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
+		if err := c.handle(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		metrics.KafkaHandled.Inc()
+
 		if err := c.reader.CommitMessages(ctx, msg); err != nil {
-			lg.Error("Failed to commit message", slog.Any("error", err))
+			lg.ErrorContext(ctx, "Failed to commit message", slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset), slog.Any("error", err))
+			continue
+		}
+		metrics.KafkaCommitted.Inc()
+	}
+
+	return ctx.Err()
+}
+
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) error {
+	ctx, span := startMessageSpan(ctx, msg)
+	defer span.End()
+	lg := c.lg.With(slog.String("op", "Consumer.handle"), slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+
+	err := c.withRetry(ctx, lg, func() error {
+		return c.handler.HandleMessage(ctx, msg)
+	})
+	if err != nil {
+		failSpan(span, err)
+		return fmt.Errorf("failed to handle message at partition %d offset %d: %w", msg.Partition, msg.Offset, err)
+	}
+	return nil
+}
+
+func (c *Consumer) workBatches(ctx context.Context, queue <-chan kafka.Message, handler BatchHandler) error {
+	lg := c.lg.With(slog.String("op", "Consumer.workBatches"))
+
+	batch := make([]kafka.Message, 0, c.batchSize)
+	linger := time.NewTimer(c.batchLinger)
+	linger.Stop()
+	defer linger.Stop()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		first, last := batch[0], batch[len(batch)-1]
+		batchLg := lg.With(slog.Int("size", len(batch)), slog.Int64("first_offset", first.Offset), slog.Int64("last_offset", last.Offset))
+
+		batchCtx, span := startBatchSpan(ctx, batch)
+		err := c.withRetry(batchCtx, batchLg, func() error {
+			return handler.HandleBatch(batchCtx, batch)
+		})
+		if err != nil {
+			failSpan(span, err)
+		}
+		span.End()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to handle batch of %d messages: %w", len(batch), err)
+		}
+		metrics.KafkaHandled.Add(float64(len(batch)))
+
+		if err := c.reader.CommitMessages(ctx, batch...); err != nil {
+			batchLg.ErrorContext(batchCtx, "Failed to commit batch", slog.Any("error", err))
+		} else {
+			metrics.KafkaCommitted.Add(float64(len(batch)))
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				return ctx.Err()
+			}
+
+			if len(batch) == 0 {
+				linger.Reset(c.batchLinger)
+			}
+			batch = append(batch, msg)
+
+			if len(batch) >= c.batchSize {
+				linger.Stop()
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-linger.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// withRetry calls fn until it succeeds, fails permanently or ctx is cancelled. Permanent
+// failures are logged and reported as success, since the message is not going to be
+// processed anyway and the consumer may move past it. After the retry attempts are used up
+// the consumer is reported as stalled until fn returns.
+func (c *Consumer) withRetry(ctx context.Context, lg *slog.Logger, fn func() error) error {
+	stalled := false
+	defer func() {
+		if stalled {
+			c.stalled.Add(-1)
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) {
+			metrics.KafkaFailed.WithLabelValues(metrics.FailurePermanent).Inc()
+			lg.WarnContext(ctx, "Message rejected", slog.String("reason", permanent.Reason), slog.Any("error", permanent.Err))
+			return nil
+		}
+
+		metrics.KafkaFailed.WithLabelValues(metrics.FailureTransient).Inc()
+		if !stalled && c.retry.Exhausted(attempt) {
+			stalled = true
+			c.stalled.Add(1)
+			lg.ErrorContext(ctx, "Failed to handle message after all attempts, retrying until it succeeds", slog.Int("attempt", attempt), slog.Any("error", err))
+		}
+
+		delay := c.retry.Backoff(attempt)
+		lg.WarnContext(ctx, "Failed to handle message, retrying", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
 		}
 	}
 }
@@ -0,0 +1,285 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"webtechl0/internal/config"
+	"webtechl0/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type fakeReader struct {
+	msgs chan kafkago.Message
+	lag  atomic.Int64
+
+	mu        sync.Mutex
+	committed []kafkago.Message
+	commits   int
+}
+
+func newFakeReader(msgs ...kafkago.Message) *fakeReader {
+	r := &fakeReader{msgs: make(chan kafkago.Message, len(msgs))}
+	for _, msg := range msgs {
+		r.msgs <- msg
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return kafkago.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	r.commits++
+	return nil
+}
+
+func (r *fakeReader) Stats() kafkago.ReaderStats {
+	return kafkago.ReaderStats{Lag: r.lag.Load()}
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func (r *fakeReader) committedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.committed)
+}
+
+// handlerFunc adapts a function to kafka.Handler.
+type handlerFunc func(ctx context.Context, msg kafkago.Message) error
+
+func (f handlerFunc) HandleMessage(ctx context.Context, msg kafkago.Message) error {
+	return f(ctx, msg)
+}
+
+func testKafkaConfig() config.Kafka {
+	return config.Kafka{
+		Workers:             4,
+		RetryMaxAttempts:    3,
+		RetryInitialBackoff: time.Millisecond,
+		RetryMaxBackoff:     time.Millisecond,
+		RetryMultiplier:     2,
+	}
+}
+
+// runConsumer starts the consumer and stops it once the reader has committed n messages.
+func runConsumer(t *testing.T, c *kafka.Consumer, reader *fakeReader, n int) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Start(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for reader.committedCount() < n {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("expected %d messages committed, got %d", n, reader.committedCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the consumer to stop on cancel, got %v", err)
+	}
+}
+
+func TestConsumerRetriesPastMaxAttempts(t *testing.T) {
+	reader := newFakeReader(kafkago.Message{Offset: 1})
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var c *kafka.Consumer
+	var attempts int
+	var stalledErr error
+	c = kafka.NewConsumerWithReader(reader, testKafkaConfig(), handlerFunc(func(ctx context.Context, msg kafkago.Message) error {
+		attempts++
+		if attempts == 5 {
+			_, stalledErr = c.Health(ctx)
+		}
+		if attempts < 10 {
+			return &kafka.TransientError{Err: errors.New("connection refused")}
+		}
+		return nil
+	}), lg)
+
+	runConsumer(t, c, reader, 1)
+
+	if attempts != 10 {
+		t.Errorf("expected the message to be retried until it succeeded, got %d attempts", attempts)
+	}
+	if !errors.Is(stalledErr, kafka.ErrConsumerStalled) {
+		t.Errorf("expected the consumer to be reported stalled after max attempts, got %v", stalledErr)
+	}
+	if _, err := c.Health(context.Background()); errors.Is(err, kafka.ErrConsumerStalled) {
+		t.Errorf("expected the consumer not to be stalled once the message succeeded, got %v", err)
+	}
+}
+
+func TestConsumerCommitsPermanentFailures(t *testing.T) {
+	reader := newFakeReader(kafkago.Message{Offset: 1}, kafkago.Message{Offset: 2})
+	cfg := testKafkaConfig()
+	cfg.Workers = 1
+
+	var mu sync.Mutex
+	var handled []int64
+	c := kafka.NewConsumerWithReader(reader, cfg, handlerFunc(func(ctx context.Context, msg kafkago.Message) error {
+		mu.Lock()
+		handled = append(handled, msg.Offset)
+		mu.Unlock()
+		if msg.Offset == 1 {
+			return &kafka.PermanentError{Reason: kafka.ReasonInvalidJSON, Err: errors.New("unexpected end of JSON input")}
+		}
+		return nil
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	runConsumer(t, c, reader, 2)
+
+	if len(handled) != 2 {
+		t.Errorf("expected the rejected message to be handled once, got %v", handled)
+	}
+	if reader.committed[0].Offset != 1 || reader.committed[1].Offset != 2 {
+		t.Errorf("expected both messages committed in order, got %v", reader.committed)
+	}
+}
+
+func TestConsumerKeepsPartitionOrder(t *testing.T) {
+	const partitions, perPartition = 6, 50
+
+	var msgs []kafkago.Message
+	for offset := range perPartition {
+		for partition := range partitions {
+			msgs = append(msgs, kafkago.Message{Partition: partition, Offset: int64(offset)})
+		}
+	}
+	reader := newFakeReader(msgs...)
+
+	var mu sync.Mutex
+	handled := make(map[int][]int64)
+	c := kafka.NewConsumerWithReader(reader, testKafkaConfig(), handlerFunc(func(ctx context.Context, msg kafkago.Message) error {
+		time.Sleep(time.Duration(rand.IntN(100)) * time.Microsecond)
+		mu.Lock()
+		handled[msg.Partition] = append(handled[msg.Partition], msg.Offset)
+		mu.Unlock()
+		return nil
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	runConsumer(t, c, reader, len(msgs))
+
+	committed := make(map[int][]int64)
+	for _, msg := range reader.committed {
+		committed[msg.Partition] = append(committed[msg.Partition], msg.Offset)
+	}
+	for partition := range partitions {
+		for i := range perPartition {
+			if handled[partition][i] != int64(i) || committed[partition][i] != int64(i) {
+				t.Fatalf("partition %d: expected offsets handled and committed in order, got %v and %v",
+					partition, handled[partition], committed[partition])
+			}
+		}
+	}
+}
+
+// batchHandler records the batches it handles along with the number of messages committed
+// by the time each batch arrived. The first failures calls fail transiently.
+type batchHandler struct {
+	reader   *fakeReader
+	failures int
+
+	mu        sync.Mutex
+	batches   [][]int64
+	committed []int
+}
+
+func (h *batchHandler) HandleMessage(ctx context.Context, msg kafkago.Message) error {
+	return h.HandleBatch(ctx, []kafkago.Message{msg})
+}
+
+func (h *batchHandler) HandleBatch(ctx context.Context, msgs []kafkago.Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.committed = append(h.committed, h.reader.committedCount())
+	if h.failures > 0 {
+		h.failures--
+		return &kafka.TransientError{Err: errors.New("connection refused")}
+	}
+
+	offsets := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		offsets = append(offsets, msg.Offset)
+	}
+	h.batches = append(h.batches, offsets)
+	return nil
+}
+
+func TestConsumerFlushesFullBatches(t *testing.T) {
+	var msgs []kafkago.Message
+	for offset := range 6 {
+		msgs = append(msgs, kafkago.Message{Offset: int64(offset)})
+	}
+	reader := newFakeReader(msgs...)
+	cfg := testKafkaConfig()
+	cfg.BatchSize = 3
+	cfg.BatchLinger = time.Hour
+
+	h := &batchHandler{reader: reader, failures: 2}
+	c := kafka.NewConsumerWithReader(reader, cfg, h, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	runConsumer(t, c, reader, len(msgs))
+
+	if len(h.batches) != 2 || len(h.batches[0]) != 3 || h.batches[0][0] != 0 || h.batches[1][0] != 3 {
+		t.Errorf("expected two full batches in order, got %v", h.batches)
+	}
+	// Two failed attempts and the successful one of the first batch, then the second batch.
+	if want := []int{0, 0, 0, 3}; !slices.Equal(h.committed, want) {
+		t.Errorf("expected each batch committed only after it was handled, got %v committed on each call", h.committed)
+	}
+	if reader.commits != 2 {
+		t.Errorf("expected a commit per batch, got %d", reader.commits)
+	}
+}
+
+func TestConsumerFlushesBatchAfterLinger(t *testing.T) {
+	reader := newFakeReader(kafkago.Message{Offset: 1}, kafkago.Message{Offset: 2})
+	cfg := testKafkaConfig()
+	cfg.BatchSize = 100
+	cfg.BatchLinger = 20 * time.Millisecond
+
+	h := &batchHandler{reader: reader}
+	c := kafka.NewConsumerWithReader(reader, cfg, h, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	start := time.Now()
+	runConsumer(t, c, reader, 2)
+
+	if elapsed := time.Since(start); elapsed < cfg.BatchLinger {
+		t.Errorf("expected the batch to wait for the linger, flushed after %v", elapsed)
+	}
+	if len(h.batches) != 1 || len(h.batches[0]) != 2 {
+		t.Errorf("expected a single partial batch, got %v", h.batches)
+	}
+	if reader.commits != 1 {
+		t.Errorf("expected the batch committed at once, got %d commits", reader.commits)
+	}
+}
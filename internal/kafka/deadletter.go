@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderReason            = "dlq-reason"
+	HeaderError             = "dlq-error"
+	HeaderValidationErrors  = "dlq-validation-errors"
+	HeaderOriginalTopic     = "dlq-original-topic"
+	HeaderOriginalPartition = "dlq-original-partition"
+	HeaderOriginalOffset    = "dlq-original-offset"
+	HeaderTimestamp         = "dlq-timestamp"
+)
+
+const (
+	ReasonInvalidJSON      = "invalid_json"
+	ReasonValidationFailed = "validation_failed"
+	ReasonPersistFailed    = "persist_failed"
+	ReasonOrderConflict    = "order_conflict"
+)
+
+type FieldError struct {
+	Field string `json:"field"`
+	Tag   string `json:"tag"`
+	Param string `json:"param,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+type DeadLetterWriter struct {
+	writer *kafka.Writer
+}
+
+func NewDeadLetterWriter(brokers []string, topic string) *DeadLetterWriter {
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	return &DeadLetterWriter{writer: writer}
+}
+
+// Publish sends the original message to the dead-letter topic, see DeadLetterMessage.
+func (w *DeadLetterWriter) Publish(ctx context.Context, msg kafka.Message, reason string, cause error) error {
+	deadLetter, err := DeadLetterMessage(msg, reason, cause, time.Now())
+	if err != nil {
+		return err
+	}
+	return w.writer.WriteMessages(ctx, deadLetter)
+}
+
+// DeadLetterMessage returns the dead-letter record of msg, rejected at now: the original key,
+// value and headers, followed by headers describing why it was rejected.
+func DeadLetterMessage(msg kafka.Message, reason string, cause error, now time.Time) (kafka.Message, error) {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+7)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderTimestamp, Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+	)
+
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderError, Value: []byte(cause.Error())})
+	}
+
+	if fieldErrors := validationErrors(cause); len(fieldErrors) > 0 {
+		data, err := json.Marshal(fieldErrors)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		headers = append(headers, kafka.Header{Key: HeaderValidationErrors, Value: data})
+	}
+
+	return kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}, nil
+}
+
+func (w *DeadLetterWriter) Close() error {
+	return w.writer.Close()
+}
+
+func validationErrors(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+
+	fieldErrors := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: fe.Namespace(),
+			Tag:   fe.Tag(),
+			Param: fe.Param(),
+			Value: fe.Value(),
+		})
+	}
+	return fieldErrors
+}
@@ -0,0 +1,100 @@
+package kafka_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"webtechl0/internal/kafka"
+	"webtechl0/internal/models"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestDeadLetterMessage(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("MSK", 3*60*60))
+	msg := kafkago.Message{
+		Topic: "orders", Partition: 3, Offset: 42, Key: []byte("b563"), Value: []byte("{}"),
+		Headers: []kafkago.Header{{Key: "traceparent", Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")}},
+	}
+
+	tests := []struct {
+		name   string
+		reason string
+		cause  error
+		want   map[string]string
+		fields []string
+	}{
+		{
+			name:   "invalid json",
+			reason: kafka.ReasonInvalidJSON,
+			cause:  errors.New("unexpected end of JSON input"),
+			want:   map[string]string{kafka.HeaderError: "unexpected end of JSON input"},
+		},
+		{
+			name:   "validation failed",
+			reason: kafka.ReasonValidationFailed,
+			cause:  models.ValidateOrder(&models.Order{}),
+			fields: []string{"Order.OrderUID", "Order.TrackNumber"},
+		},
+		{
+			name:   "no cause",
+			reason: kafka.ReasonPersistFailed,
+			want:   map[string]string{kafka.HeaderError: ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetter, err := kafka.DeadLetterMessage(msg, tt.reason, tt.cause, now)
+			if err != nil {
+				t.Fatalf("failed to build dead-letter message: %v", err)
+			}
+			if string(deadLetter.Key) != "b563" || string(deadLetter.Value) != "{}" {
+				t.Errorf("expected the original key and value, got %q %q", deadLetter.Key, deadLetter.Value)
+			}
+
+			headers := make(map[string]string)
+			for _, header := range deadLetter.Headers {
+				headers[header.Key] = string(header.Value)
+			}
+
+			want := map[string]string{
+				"traceparent":                 "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				kafka.HeaderReason:            tt.reason,
+				kafka.HeaderOriginalTopic:     "orders",
+				kafka.HeaderOriginalPartition: "3",
+				kafka.HeaderOriginalOffset:    "42",
+				kafka.HeaderTimestamp:         "2024-01-02T00:04:05.000000006Z",
+			}
+			for key, value := range tt.want {
+				want[key] = value
+			}
+			for key, value := range want {
+				if got, ok := headers[key]; value == "" && ok || value != "" && got != value {
+					t.Errorf("header %s: expected %q, got %q", key, value, got)
+				}
+			}
+
+			var fieldErrors []kafka.FieldError
+			if v, ok := headers[kafka.HeaderValidationErrors]; ok {
+				if err := json.Unmarshal([]byte(v), &fieldErrors); err != nil {
+					t.Fatalf("failed to decode validation errors: %v", err)
+				}
+			}
+			fields := make(map[string]bool)
+			for _, fe := range fieldErrors {
+				fields[fe.Field] = fe.Tag != ""
+			}
+			for _, field := range tt.fields {
+				if !fields[field] {
+					t.Errorf("expected a validation error for %s, got %+v", field, fieldErrors)
+				}
+			}
+			if len(tt.fields) == 0 && len(fieldErrors) != 0 {
+				t.Errorf("expected no validation errors, got %+v", fieldErrors)
+			}
+		})
+	}
+}
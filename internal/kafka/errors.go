@@ -0,0 +1,30 @@
+package kafka
+
+// PermanentError means the message can never be processed successfully,
+// retrying it is pointless and the consumer may move past it.
+type PermanentError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// TransientError means the message may be processed successfully later,
+// for example once the database is reachable again.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "transient: " + e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
@@ -3,46 +3,227 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"webtechl0/internal/metrics"
 	"webtechl0/internal/models"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OrderService interface {
 	CreateOrder(ctx context.Context, order *models.Order) error
+	CreateOrders(ctx context.Context, orders []*models.Order) ([]error, error)
+}
+
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, msg kafka.Message, reason string, cause error) error
+}
+
+type messageID struct {
+	topic     string
+	partition int
+	offset    int64
 }
 
 type OrderHandler struct {
 	orderService OrderService
-	validator    *validator.Validate
+	deadLetter   DeadLetterPublisher
 	lg           *slog.Logger
+
+	// deadLettered holds the messages of batches being retried that are already published
+	// to the dead-letter topic, so that a retry does not publish them again.
+	deadLetteredMutex sync.Mutex
+	deadLettered      map[messageID]struct{}
 }
 
-func NewOrderHandler(orderService OrderService, lg *slog.Logger) *OrderHandler {
-	return &OrderHandler{orderService: orderService, lg: lg, validator: validator.New()}
+// NewOrderHandler creates a handler for order messages. Rejected messages are published
+// to deadLetter, if it is nil they are only logged.
+func NewOrderHandler(orderService OrderService, deadLetter DeadLetterPublisher, lg *slog.Logger) *OrderHandler {
+	return &OrderHandler{orderService: orderService, deadLetter: deadLetter, lg: lg, deadLettered: make(map[messageID]struct{})}
 }
 
-func (h *OrderHandler) HandleMessage(ctx context.Context, data []byte) error {
-	op := "OrderHandler.HandleMessage"
-	var order models.Order
-	if err := json.Unmarshal(data, &order); err != nil {
-		h.lg.Warn("Invalid JSON", slog.String("op", op), slog.Any("error", err))
-		return nil
+func (h *OrderHandler) HandleMessage(ctx context.Context, msg kafka.Message) (err error) {
+	defer func() { h.settle(err, msg) }()
+	return h.handleMessage(ctx, msg)
+}
+
+func (h *OrderHandler) handleMessage(ctx context.Context, msg kafka.Message) error {
+	order, err := h.decode(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	lg := h.lg.With("op", "OrderHandler.HandleMessage", "order_uid", order.OrderUID)
+
+	if err := h.orderService.CreateOrder(ctx, order); err != nil {
+		if errors.Is(err, models.ErrTransient) || ctx.Err() != nil {
+			lg.WarnContext(ctx, "Failed to save order, will retry", slog.Any("error", err))
+			return &TransientError{Err: err}
+		}
+
+		if errors.Is(err, models.ErrOrderExists) {
+			lg.InfoContext(ctx, "Order already exists")
+			return nil
+		}
+
+		if errors.Is(err, models.ErrOrderConflict) {
+			lg.WarnContext(ctx, "Order conflicts with existing order", slog.Any("error", err))
+			return h.reject(ctx, msg, ReasonOrderConflict, err)
+		}
+
+		lg.ErrorContext(ctx, "Failed to save order", slog.Any("error", err))
+		return h.reject(ctx, msg, ReasonPersistFailed, err)
 	}
 
-	lg := h.lg.With("op", op, "order_uid", order.OrderUID)
+	lg.InfoContext(ctx, "Created order")
+	return nil
+}
+
+// HandleBatch decodes and validates the messages and saves the valid orders in one
+// transaction. Each message gets its own span, which its logs refer to. If the batch fails
+// permanently, the messages are handled one by one, so only the offending message is
+// dead-lettered. When the batch is retried after a transient failure, messages that were
+// already dead-lettered are not published again.
+func (h *OrderHandler) HandleBatch(ctx context.Context, msgs []kafka.Message) (err error) {
+	lg := h.lg.With("op", "OrderHandler.HandleBatch", "size", len(msgs))
+	defer func() { h.settle(err, msgs...) }()
+
+	orders := make([]*models.Order, 0, len(msgs))
+	accepted := make([]kafka.Message, 0, len(msgs))
+	contexts := make([]context.Context, 0, len(msgs))
+	spans := make([]trace.Span, 0, len(msgs))
+	defer func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}()
+
+	for _, msg := range msgs {
+		msgCtx, span := startMessageSpan(ctx, msg)
+		spans = append(spans, span)
 
-	if err := h.validator.Struct(order); err != nil {
-		lg.Warn("Validation failed", slog.Any("error", err))
+		order, err := h.decode(msgCtx, msg)
+		if err != nil {
+			var permanent *PermanentError
+			if errors.As(err, &permanent) {
+				continue
+			}
+			return err
+		}
+		orders = append(orders, order)
+		accepted = append(accepted, msg)
+		contexts = append(contexts, msgCtx)
+	}
+
+	if len(orders) == 0 {
 		return nil
 	}
 
-	if err := h.orderService.CreateOrder(ctx, &order); err != nil {
-		lg.Error("Failed to save order", slog.Any("error", err))
+	results, err := h.orderService.CreateOrders(ctx, orders)
+	if err != nil {
+		if errors.Is(err, models.ErrTransient) || ctx.Err() != nil {
+			lg.WarnContext(ctx, "Failed to save batch, will retry", slog.Any("error", err))
+			return &TransientError{Err: err}
+		}
+
+		lg.ErrorContext(ctx, "Failed to save batch, handling messages one by one", slog.Any("error", err))
+		for i, msg := range accepted {
+			if err := h.handleMessage(contexts[i], msg); err != nil {
+				var permanent *PermanentError
+				if !errors.As(err, &permanent) {
+					return err
+				}
+			}
+		}
 		return nil
 	}
 
-	lg.Info("Created order")
+	for i, err := range results {
+		if err == nil {
+			continue
+		}
+
+		h.lg.WarnContext(contexts[i], "Order conflicts with existing order", slog.String("order_uid", orders[i].OrderUID), slog.Any("error", err))
+		if err := h.reject(contexts[i], accepted[i], ReasonOrderConflict, err); err != nil {
+			var permanent *PermanentError
+			if !errors.As(err, &permanent) {
+				return err
+			}
+		}
+	}
+
+	lg.InfoContext(ctx, "Created orders", slog.Int("orders", len(orders)))
 	return nil
 }
+
+// decode parses and validates the order. Invalid messages are rejected.
+func (h *OrderHandler) decode(ctx context.Context, msg kafka.Message) (*models.Order, error) {
+	op := "OrderHandler.decode"
+	var order models.Order
+	if err := json.Unmarshal(msg.Value, &order); err != nil {
+		h.lg.WarnContext(ctx, "Invalid JSON", slog.String("op", op), slog.Any("error", err))
+		return nil, h.reject(ctx, msg, ReasonInvalidJSON, err)
+	}
+
+	if err := models.ValidateOrder(&order); err != nil {
+		h.lg.WarnContext(ctx, "Validation failed", slog.String("op", op), slog.String("order_uid", order.OrderUID), slog.Any("error", err))
+		return nil, h.reject(ctx, msg, ReasonValidationFailed, err)
+	}
+
+	return &order, nil
+}
+
+// reject dead-letters the message and reports it as a permanent failure. If the dead-letter
+// topic is unreachable the failure is reported as transient, so the message is not lost.
+func (h *OrderHandler) reject(ctx context.Context, msg kafka.Message, reason string, cause error) error {
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, "rejected: "+reason)
+	if h.deadLetter == nil || h.wasDeadLettered(msg) {
+		return &PermanentError{Reason: reason, Err: cause}
+	}
+
+	if err := h.deadLetter.Publish(ctx, msg, reason, cause); err != nil {
+		h.lg.ErrorContext(ctx, "Failed to publish message to dead-letter topic", slog.String("reason", reason), slog.Any("error", err))
+		return &TransientError{Err: fmt.Errorf("failed to publish to dead-letter topic: %w", err)}
+	}
+	h.markDeadLettered(msg)
+
+	metrics.KafkaDeadLettered.WithLabelValues(reason).Inc()
+	h.lg.InfoContext(ctx, "Published message to dead-letter topic", slog.String("reason", reason), slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+	return &PermanentError{Reason: reason, Err: cause}
+}
+
+func (h *OrderHandler) wasDeadLettered(msg kafka.Message) bool {
+	h.deadLetteredMutex.Lock()
+	defer h.deadLetteredMutex.Unlock()
+
+	_, ok := h.deadLettered[messageID{msg.Topic, msg.Partition, msg.Offset}]
+	return ok
+}
+
+func (h *OrderHandler) markDeadLettered(msg kafka.Message) {
+	h.deadLetteredMutex.Lock()
+	defer h.deadLetteredMutex.Unlock()
+
+	h.deadLettered[messageID{msg.Topic, msg.Partition, msg.Offset}] = struct{}{}
+}
+
+// settle forgets which of the messages were dead-lettered, unless they are going to be
+// retried after the transient error err.
+func (h *OrderHandler) settle(err error, msgs ...kafka.Message) {
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return
+	}
+
+	h.deadLetteredMutex.Lock()
+	defer h.deadLetteredMutex.Unlock()
+
+	for _, msg := range msgs {
+		delete(h.deadLettered, messageID{msg.Topic, msg.Partition, msg.Offset})
+	}
+}
@@ -0,0 +1,129 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"webtechl0/internal/kafka"
+	"webtechl0/internal/models"
+	"webtechl0/internal/testutil"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type conflictingOrderService struct{}
+
+func (conflictingOrderService) CreateOrder(ctx context.Context, order *models.Order) error {
+	return models.ErrOrderConflict
+}
+
+func (conflictingOrderService) CreateOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	results := make([]error, len(orders))
+	for i := range results {
+		results[i] = models.ErrOrderConflict
+	}
+	return results, nil
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(ctx context.Context, msg kafkago.Message, reason string, cause error) error {
+	return nil
+}
+
+// flakyPublisher fails the first publication of each offset in fail and counts the others.
+type flakyPublisher struct {
+	fail      map[int64]bool
+	published map[int64]int
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, msg kafkago.Message, reason string, cause error) error {
+	if p.fail[msg.Offset] {
+		delete(p.fail, msg.Offset)
+		return errors.New("leader not available")
+	}
+	p.published[msg.Offset]++
+	return nil
+}
+
+func TestHandleBatchTracesMessages(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	h := kafka.NewOrderHandler(conflictingOrderService{}, discardPublisher{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	traced := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	msgs := []kafkago.Message{
+		{Topic: "orders", Partition: 2, Offset: 41, Value: testutil.OrderJSON(t, "a"), Headers: []kafkago.Header{{Key: "traceparent", Value: []byte(traced)}}},
+		{Topic: "orders", Partition: 2, Offset: 42, Value: testutil.OrderJSON(t, "b")},
+	}
+
+	if err := h.HandleBatch(context.Background(), msgs); err != nil {
+		t.Fatalf("failed to handle batch: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected a span per message, got %d", len(spans))
+	}
+
+	for i, span := range spans {
+		attrs := attribute.NewSet(span.Attributes...)
+		if partition, _ := attrs.Value("messaging.destination.partition.id"); partition.AsString() != "2" {
+			t.Errorf("span %d: expected partition 2, got %q", i, partition.AsString())
+		}
+		if offset, _ := attrs.Value("messaging.kafka.offset"); offset.AsInt64() != msgs[i].Offset {
+			t.Errorf("span %d: expected offset %d, got %d", i, msgs[i].Offset, offset.AsInt64())
+		}
+		if span.Status.Code != codes.Error || span.Status.Description != "rejected: "+kafka.ReasonOrderConflict {
+			t.Errorf("span %d: expected rejected status, got %+v", i, span.Status)
+		}
+	}
+
+	if got := spans[0]; got.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		got.Parent.SpanID().String() != "00f067aa0ba902b7" || !got.Parent.IsRemote() {
+		t.Errorf("expected the first span to continue the producer's trace, got parent %v", got.Parent)
+	}
+	if got := spans[1]; got.Parent.IsValid() || got.SpanContext.TraceID() == spans[0].SpanContext.TraceID() {
+		t.Errorf("expected the second span to start a new trace, got parent %v", got.Parent)
+	}
+}
+
+func TestHandleBatchRetryDoesNotRepublish(t *testing.T) {
+	publisher := &flakyPublisher{fail: map[int64]bool{2: true}, published: make(map[int64]int)}
+	h := kafka.NewOrderHandler(conflictingOrderService{}, publisher, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	msgs := []kafkago.Message{
+		{Topic: "orders", Offset: 1, Value: []byte("{")},
+		{Topic: "orders", Offset: 2, Value: testutil.OrderJSON(t, "a")},
+	}
+
+	var transient *kafka.TransientError
+	if err := h.HandleBatch(context.Background(), msgs); !errors.As(err, &transient) {
+		t.Fatalf("expected a transient error when the dead-letter topic fails, got %v", err)
+	}
+	if err := h.HandleBatch(context.Background(), msgs); err != nil {
+		t.Fatalf("failed to handle batch on retry: %v", err)
+	}
+	if publisher.published[1] != 1 || publisher.published[2] != 1 {
+		t.Errorf("expected each message dead-lettered once, got %v", publisher.published)
+	}
+
+	// Once the batch is done with, the same offsets are not remembered.
+	if err := h.HandleBatch(context.Background(), msgs[:1]); err != nil {
+		t.Fatalf("failed to handle batch: %v", err)
+	}
+	if publisher.published[1] != 2 {
+		t.Errorf("expected the message to be dead-lettered again in a new batch, got %v", publisher.published)
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// pingInterval is how long a broker ping result is reused, so that frequent readiness probes
+// do not open a connection each.
+const pingInterval = 10 * time.Second
+
+var (
+	ErrConsumerLagging    = errors.New("consumer lag is too high")
+	ErrConsumerStalled    = errors.New("consumer is stalled retrying a message")
+	ErrConsumerNotRunning = errors.New("consumer is not running")
+)
+
+// ConsumerHealth is the state of the consumer reported by the readiness check.
+type ConsumerHealth struct {
+	// Lag is the number of messages behind the end of the partition as of the last fetch,
+	// as reported by the reader.
+	Lag    int64 `json:"lag"`
+	MaxLag int64 `json:"max_lag,omitempty"`
+}
+
+// Health checks that the consumer is running and not stalled, that a broker is reachable and
+// that the lag is within the limit set in config, zero limit disables the lag check.
+func (c *Consumer) Health(ctx context.Context) (ConsumerHealth, error) {
+	health := ConsumerHealth{Lag: c.reader.Stats().Lag, MaxLag: c.maxLag}
+
+	if !c.running.Load() {
+		return health, ErrConsumerNotRunning
+	}
+	if stalled := c.stalled.Load(); stalled > 0 {
+		return health, fmt.Errorf("%w: %d workers", ErrConsumerStalled, stalled)
+	}
+
+	if err := c.ping(ctx); err != nil {
+		return health, err
+	}
+	if c.maxLag > 0 && health.Lag > c.maxLag {
+		return health, fmt.Errorf("%w: %d messages behind", ErrConsumerLagging, health.Lag)
+	}
+	return health, nil
+}
+
+// ping succeeds as soon as one of the brokers accepts a connection. The result is reused for
+// pingInterval.
+func (c *Consumer) ping(ctx context.Context) error {
+	c.pingMutex.Lock()
+	defer c.pingMutex.Unlock()
+
+	if !c.pingedAt.IsZero() && time.Since(c.pingedAt) < pingInterval {
+		return c.pingErr
+	}
+
+	c.pingErr = c.dialBrokers(ctx)
+	// A probe that gave up is not a verdict on the brokers.
+	if ctx.Err() == nil {
+		c.pingedAt = time.Now()
+	}
+	return c.pingErr
+}
+
+func (c *Consumer) dialBrokers(ctx context.Context) error {
+	if len(c.brokers) == 0 {
+		return errors.New("no kafka brokers configured")
+	}
+
+	var errs []error
+	for _, broker := range c.brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no kafka broker is reachable: %w", errors.Join(errs...))
+}
@@ -0,0 +1,81 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"webtechl0/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// listenBroker accepts and closes connections, counting them.
+func listenBroker(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+func TestConsumerHealth(t *testing.T) {
+	broker, accepted := listenBroker(t)
+	cfg := testKafkaConfig()
+	cfg.Brokers = []string{broker}
+	cfg.HealthMaxLag = 100
+
+	reader := newFakeReader()
+	reader.lag.Store(40)
+	c := kafka.NewConsumerWithReader(reader, cfg, handlerFunc(func(ctx context.Context, msg kafkago.Message) error {
+		return nil
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := c.Health(context.Background()); !errors.Is(err, kafka.ErrConsumerNotRunning) {
+		t.Errorf("expected the consumer not to be running before Start, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	health, err := c.Health(context.Background())
+	for errors.Is(err, kafka.ErrConsumerNotRunning) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		health, err = c.Health(context.Background())
+	}
+	if err != nil || health.Lag != 40 {
+		t.Fatalf("expected healthy with lag 40, got %+v %v", health, err)
+	}
+
+	reader.lag.Store(150)
+	if health, err := c.Health(context.Background()); !errors.Is(err, kafka.ErrConsumerLagging) || health.Lag != 150 {
+		t.Errorf("expected the lag over the limit to fail, got %+v %v", health, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("expected the broker to be dialed once for repeated checks, got %d", n)
+	}
+}
@@ -0,0 +1,57 @@
+package kafka
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"webtechl0/internal/config"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts after which the consumer is reported as stalled,
+	// zero means never. The message is retried at MaxBackoff until it succeeds either way.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the delay that is randomised, 0.2 gives delays in [0.8d, 1.2d].
+	Jitter float64
+}
+
+func NewRetryPolicy(cfg config.Kafka) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    cfg.RetryMaxAttempts,
+		InitialBackoff: cfg.RetryInitialBackoff,
+		MaxBackoff:     cfg.RetryMaxBackoff,
+		Multiplier:     cfg.RetryMultiplier,
+		Jitter:         cfg.RetryJitter,
+	}
+}
+
+// Exhausted reports whether the given number of attempts uses up MaxAttempts.
+func (p RetryPolicy) Exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,46 @@
+package kafka_test
+
+import (
+	"testing"
+	"time"
+
+	"webtechl0/internal/kafka"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := kafka.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := p.Backoff(i + 1); got != want {
+			t.Errorf("attempt %d: expected backoff %v, got %v", i+1, want, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for attempt := 1; attempt <= 10; attempt++ {
+		got := p.Backoff(attempt)
+		if got < 50*time.Millisecond || got > 1500*time.Millisecond {
+			t.Errorf("attempt %d: backoff %v out of jitter bounds", attempt, got)
+		}
+	}
+
+	if p.Exhausted(4) {
+		t.Errorf("expected attempts left after 4 of 5")
+	}
+	if !p.Exhausted(5) {
+		t.Errorf("expected no attempts left after 5 of 5")
+	}
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "webtechl0/internal/kafka"
+
+// headerCarrier lets the propagator read and write trace context in message headers.
+type headerCarrier []kafka.Header
+
+func (c *headerCarrier) Get(key string) string {
+	for _, header := range *c {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c *headerCarrier) Set(key, value string) {
+	for i, header := range *c {
+		if header.Key == key {
+			(*c)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c = append(*c, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c *headerCarrier) Keys() []string {
+	keys := make([]string, len(*c))
+	for i, header := range *c {
+		keys[i] = header.Key
+	}
+	return keys
+}
+
+// startMessageSpan starts the span of processing the message. A message with a traceparent
+// header continues the producer's trace, any other message gets a child span of ctx.
+func startMessageSpan(ctx context.Context, msg kafka.Message) (context.Context, trace.Span) {
+	carrier := headerCarrier(msg.Headers)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, &carrier)
+
+	attrs := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaOffset(int(msg.Offset)),
+		),
+	}
+	if len(msg.Key) > 0 {
+		attrs = append(attrs, trace.WithAttributes(semconv.MessagingKafkaMessageKey(string(msg.Key))))
+	}
+	return otel.Tracer(tracerName).Start(ctx, "process "+msg.Topic, attrs...)
+}
+
+// startBatchSpan starts the span of processing a batch, the messages get their own spans.
+func startBatchSpan(ctx context.Context, msgs []kafka.Message) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "process batch "+msgs[0].Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(msgs[0].Topic),
+			semconv.MessagingBatchMessageCount(len(msgs)),
+		),
+	)
+}
+
+// failSpan marks the span as failed.
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
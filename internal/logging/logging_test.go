@@ -0,0 +1,40 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"webtechl0/internal/logging"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	lg := slog.New(logging.NewContextHandler(slog.NewJSONHandler(&buf, nil))).With(slog.String("op", "test"))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	ctx := trace.ContextWithSpanContext(logging.WithRequestID(context.Background(), "req-1"), sc)
+	lg.InfoContext(ctx, "with context")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode log record: %v", err)
+	}
+	if record["request_id"] != "req-1" || record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		record["span_id"] != "00f067aa0ba902b7" || record["op"] != "test" {
+		t.Errorf("expected request and trace IDs in the record, got %v", record)
+	}
+
+	buf.Reset()
+	lg.Info("without context")
+	if bytes.Contains(buf.Bytes(), []byte("request_id")) || bytes.Contains(buf.Bytes(), []byte("trace_id")) {
+		t.Errorf("expected no IDs without a context, got %s", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"webtechl0/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	KafkaFetched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_messages_fetched_total",
+		Help: "Number of messages fetched from Kafka.",
+	})
+
+	KafkaHandled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_messages_handled_total",
+		Help: "Number of messages handled, including messages rejected permanently.",
+	})
+
+	KafkaFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_failed_total",
+		Help: "Number of failed attempts to handle a message, by kind of failure.",
+	}, []string{"kind"})
+
+	KafkaCommitted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_messages_committed_total",
+		Help: "Number of messages whose offsets were committed.",
+	})
+
+	KafkaDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_dead_lettered_total",
+		Help: "Number of messages published to the dead-letter topic, by reason.",
+	}, []string{"reason"})
+
+	OrderLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "order_lookups_total",
+		Help: "Number of order lookups by the source that served them.",
+	}, []string{"source"})
+
+	CacheRemovals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_removals_total",
+		Help: "Number of entries that left the cache, by cache and reason.",
+	}, []string{"cache", "reason"})
+
+	OrderConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_conflicts_total",
+		Help: "Number of orders rejected because an order with the same UID and different content exists.",
+	})
+)
+
+const (
+	FailureTransient = "transient"
+	FailurePermanent = "permanent"
+
+	SourceCache         = "cache"
+	SourceNegativeCache = "negative_cache"
+	SourceDB            = "db"
+)
+
+type cacheCollector struct {
+	stats func() cache.Stats
+
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	size        *prometheus.Desc
+	capacity    *prometheus.Desc
+	weight      *prometheus.Desc
+	maxWeight   *prometheus.Desc
+	errors      *prometheus.Desc
+}
+
+// RegisterCache exposes the statistics of a cache under the given name.
+func RegisterCache(name string, stats func() cache.Stats) {
+	labels := prometheus.Labels{"cache": name}
+	prometheus.MustRegister(&cacheCollector{
+		stats:       stats,
+		hits:        prometheus.NewDesc("cache_hits_total", "Number of cache hits.", nil, labels),
+		misses:      prometheus.NewDesc("cache_misses_total", "Number of cache misses.", nil, labels),
+		evictions:   prometheus.NewDesc("cache_evictions_total", "Number of entries evicted to free capacity.", nil, labels),
+		expirations: prometheus.NewDesc("cache_expirations_total", "Number of entries removed after their TTL.", nil, labels),
+		size:        prometheus.NewDesc("cache_size", "Number of entries in the cache.", nil, labels),
+		capacity:    prometheus.NewDesc("cache_capacity", "Maximum number of entries in the cache.", nil, labels),
+		weight:      prometheus.NewDesc("cache_weight_bytes", "Estimated size of the entries in the cache.", nil, labels),
+		maxWeight:   prometheus.NewDesc("cache_max_weight_bytes", "Maximum estimated size of the entries, zero if unbounded.", nil, labels),
+		errors:      prometheus.NewDesc("cache_errors_total", "Number of failed reads and writes of an on-disk cache.", nil, labels),
+	})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.size
+	ch <- c.capacity
+	ch <- c.weight
+	ch <- c.maxWeight
+	ch <- c.errors
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(s.Expirations))
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(s.Size))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(s.Capacity))
+	ch <- prometheus.MustNewConstMetric(c.weight, prometheus.GaugeValue, float64(s.Weight))
+	ch <- prometheus.MustNewConstMetric(c.maxWeight, prometheus.GaugeValue, float64(s.MaxWeight))
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(s.Errors))
+}
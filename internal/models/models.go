@@ -2,13 +2,35 @@ package models
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
 var (
 	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderConflict = errors.New("order conflicts with existing order")
+	ErrOrderExists   = errors.New("order already exists")
+	ErrTransient     = errors.New("transient storage error")
+
+	ErrWarmupInProgress = errors.New("cache warm-up is already in progress")
 )
 
+// OrderConflictError is returned when an order with the same UID but different content
+// already exists. It matches ErrOrderConflict with errors.Is.
+type OrderConflictError struct {
+	OrderUID     string
+	ExistingHash string
+	IncomingHash string
+}
+
+func (e *OrderConflictError) Error() string {
+	return fmt.Sprintf("order %s conflicts with existing order: payload hash %s, existing %s", e.OrderUID, e.IncomingHash, e.ExistingHash)
+}
+
+func (e *OrderConflictError) Is(target error) bool {
+	return target == ErrOrderConflict
+}
+
 type Order struct {
 	OrderUID          string    `json:"order_uid" validate:"required"`
 	TrackNumber       string    `json:"track_number" validate:"required"`
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// InvalidParamError reports a request parameter that could not be parsed.
+type InvalidParamError struct {
+	Param  string
+	Value  string
+	Reason string
+}
+
+func (e *InvalidParamError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Param, e.Value, e.Reason)
+}
+
+type OrderFilter struct {
+	CustomerID      string
+	DeliveryService string
+	Locale          string
+	Currency        string
+	// CreatedFrom and CreatedTo bound date_created inclusively, zero values are ignored.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+type OrdersQuery struct {
+	Filter OrderFilter
+	Limit  int
+	// Ascending sorts orders from oldest to newest, by default the newest come first.
+	Ascending bool
+	// After is the position of the last order of the previous page.
+	After *OrderCursor
+}
+
+type OrdersPage struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// OrderCursor is a position in the list of orders sorted by date_created and order_uid.
+type OrderCursor struct {
+	DateCreated time.Time `json:"d"`
+	OrderUID    string    `json:"u"`
+	Ascending   bool      `json:"a,omitempty"`
+}
+
+func (c OrderCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c OrderCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.OrderUID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
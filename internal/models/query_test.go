@@ -0,0 +1,38 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"webtechl0/internal/models"
+)
+
+func TestOrderCursorRoundTrip(t *testing.T) {
+	for _, cursor := range []models.OrderCursor{
+		{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.UTC), OrderUID: "b563"},
+		{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OrderUID: "a/b?c", Ascending: true},
+	} {
+		got, err := models.DecodeOrderCursor(cursor.Encode())
+		if err != nil {
+			t.Fatalf("failed to decode cursor %+v: %v", cursor, err)
+		}
+		if !got.DateCreated.Equal(cursor.DateCreated) || got.OrderUID != cursor.OrderUID || got.Ascending != cursor.Ascending {
+			t.Errorf("expected %+v, got %+v", cursor, *got)
+		}
+	}
+}
+
+func TestDecodeOrderCursorInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"d":"2021-11-26T06:22:19Z"}`)),
+	} {
+		if _, err := models.DecodeOrderCursor(s); !errors.Is(err, models.ErrInvalidCursor) {
+			t.Errorf("expected %q to be an invalid cursor, got %v", s, err)
+		}
+	}
+}
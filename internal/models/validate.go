@@ -0,0 +1,12 @@
+package models
+
+import "github.com/go-playground/validator/v10"
+
+// validate caches struct metadata and is safe for concurrent use, so it is shared.
+var validate = validator.New()
+
+// ValidateOrder checks the order against its validate tags. Orders are validated the same
+// way whether they come from Kafka or over HTTP.
+func ValidateOrder(order *Order) error {
+	return validate.Struct(order)
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"webtechl0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type batchOrder struct {
+	order   *models.Order
+	payload []byte
+	hash    string
+	// first is the index of the first order in the batch with the same order_uid, or -1.
+	first int
+}
+
+// CreateOrders saves the orders in a single transaction. Orders are inserted with one
+// round trip per table and items are loaded with COPY.
+//
+// The returned slice holds the outcome of each order: nil if it was saved or already
+// exists with identical content, *models.OrderConflictError if it conflicts with a stored
+// order or with an earlier order of the same batch. Conflicts are recorded in order_conflicts.
+func (r *OrderRepository) CreateOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	batch := make([]batchOrder, len(orders))
+	firstByUID := make(map[string]int, len(orders))
+	for i, order := range orders {
+		payload, hash, err := orderPayload(order)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode order %s: %w", order.OrderUID, err)
+		}
+
+		first, ok := firstByUID[order.OrderUID]
+		if !ok {
+			first = -1
+			firstByUID[order.OrderUID] = i
+		}
+		batch[i] = batchOrder{order: order, payload: payload, hash: hash, first: first}
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback(ctx)
+
+	inserted, err := r.insertOrders(ctx, tx, batch)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to create orders: %w", err))
+	}
+
+	results, err := r.resolveDuplicates(ctx, tx, batch, inserted)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	var created []*models.Order
+	for i, b := range batch {
+		if inserted[i] {
+			created = append(created, b.order)
+		}
+	}
+
+	if err := r.insertDetails(ctx, tx, created); err != nil {
+		return nil, classify(err)
+	}
+
+	if err := r.createItems(ctx, tx, created...); err != nil {
+		return nil, classify(fmt.Errorf("failed to create items: %w", err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, classify(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+
+	return results, nil
+}
+
+func (r *OrderRepository) insertOrders(ctx context.Context, tx pgx.Tx, batch []batchOrder) ([]bool, error) {
+	inserted := make([]bool, len(batch))
+
+	pgBatch := &pgx.Batch{}
+	for _, b := range batch {
+		if b.first < 0 {
+			pgBatch.Queue(insertOrderQuery, orderArgs(b.order, b.hash)...)
+		}
+	}
+
+	results := tx.SendBatch(ctx, pgBatch)
+	for i, b := range batch {
+		if b.first >= 0 {
+			continue
+		}
+
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return nil, err
+		}
+		inserted[i] = tag.RowsAffected() == 1
+	}
+
+	return inserted, results.Close()
+}
+
+// resolveDuplicates compares orders that were not inserted with the stored ones and with
+// earlier orders of the batch, and records conflicts.
+func (r *OrderRepository) resolveDuplicates(ctx context.Context, tx pgx.Tx, batch []batchOrder, inserted []bool) ([]error, error) {
+	var existingUIDs []string
+	incoming := make(map[string]*models.Order)
+	for i, b := range batch {
+		if b.first < 0 && !inserted[i] {
+			existingUIDs = append(existingUIDs, b.order.OrderUID)
+			incoming[b.order.OrderUID] = b.order
+		}
+	}
+
+	existingHashes := make(map[string]*string, len(existingUIDs))
+	if len(existingUIDs) > 0 {
+		query := `SELECT order_uid, payload_hash FROM orders WHERE order_uid = ANY($1)`
+		rows, err := tx.Query(ctx, query, existingUIDs)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to select payload hashes: %w", err))
+		}
+
+		for rows.Next() {
+			var uid string
+			var hash *string
+			if err := rows.Scan(&uid, &hash); err != nil {
+				rows.Close()
+				return nil, classify(fmt.Errorf("failed to scan payload hash: %w", err))
+			}
+			existingHashes[uid] = hash
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, classify(fmt.Errorf("rows iteration error: %w", err))
+		}
+
+		if err := r.legacyHashes(ctx, tx, existingHashes, incoming); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]error, len(batch))
+	pgBatch := &pgx.Batch{}
+	for i, b := range batch {
+		var existing *string
+		switch {
+		case inserted[i]:
+			continue
+		case b.first >= 0:
+			first := batch[b.first]
+			if first.hash == b.hash {
+				// An identical copy shares the outcome of the first order.
+				results[i] = results[b.first]
+				continue
+			}
+			existing = &first.hash
+		default:
+			// An order that is gone by now has no hash to compare with.
+			existing = existingHashes[b.order.OrderUID]
+			if existing == nil || *existing == b.hash {
+				continue
+			}
+		}
+
+		results[i] = &models.OrderConflictError{OrderUID: b.order.OrderUID, ExistingHash: *existing, IncomingHash: b.hash}
+		pgBatch.Queue(insertConflictQuery, b.order.OrderUID, *existing, b.hash, b.payload)
+	}
+
+	if pgBatch.Len() > 0 {
+		if err := tx.SendBatch(ctx, pgBatch).Close(); err != nil {
+			return nil, classify(fmt.Errorf("failed to record order conflicts: %w", err))
+		}
+	}
+
+	return results, nil
+}
+
+func (r *OrderRepository) insertDetails(ctx context.Context, tx pgx.Tx, orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	pgBatch := &pgx.Batch{}
+	for _, order := range orders {
+		pgBatch.Queue(insertDeliveryQuery, deliveryArgs(&order.Delivery, order.OrderUID)...)
+		pgBatch.Queue(insertPaymentQuery, paymentArgs(&order.Payment, order.OrderUID)...)
+	}
+
+	if err := tx.SendBatch(ctx, pgBatch).Close(); err != nil {
+		return classify(fmt.Errorf("failed to create deliveries and payments: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"webtechl0/internal/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// classify marks errors that are worth retrying with models.ErrTransient, once.
+func classify(err error) error {
+	if err == nil || errors.Is(err, models.ErrTransient) || !isTransient(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", models.ErrTransient, err)
+}
+
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", // connection exception
+			"40", // transaction rollback: serialization failure, deadlock
+			"53": // insufficient resources
+			return true
+		}
+		switch pgErr.Code {
+		case "55P03", // lock not available
+			"57P01", // admin shutdown
+			"57P02", // crash shutdown
+			"57P03": // cannot connect now
+			return true
+		}
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) ||
+		pgconn.Timeout(err) ||
+		pgconn.SafeToRetry(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
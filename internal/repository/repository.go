@@ -2,7 +2,13 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"webtechl0/internal/models"
 
@@ -18,82 +24,247 @@ func NewOrderRepository(db *pgxpool.Pool) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+// CreateOrder saves the order in a single transaction. Saving an order that already exists
+// with identical content changes nothing and reports models.ErrOrderExists, while different
+// content under the same order_uid is recorded in order_conflicts and reported as
+// *models.OrderConflictError. Every statement is traced as a child span of the method's span.
+func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order) (err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.CreateOrder")
+	defer func() { endSpan(span, err) }()
+
+	payload, hash, err := orderPayload(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode order: %w", err)
+	}
+
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return classify(fmt.Errorf("failed to begin transaction: %w", err))
 	}
 	defer tx.Rollback(ctx)
 
-	if err := r.createOrder(ctx, tx, order); err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
+	inserted, err := r.createOrder(ctx, tx, order, hash)
+	if err != nil {
+		return classify(fmt.Errorf("failed to create order: %w", err))
+	}
+
+	if !inserted {
+		return r.resolveDuplicate(ctx, tx, order, payload, hash)
 	}
 
 	if err := r.createDelivery(ctx, tx, &order.Delivery, order.OrderUID); err != nil {
-		return fmt.Errorf("failed to create delivery: %w", err)
+		return classify(fmt.Errorf("failed to create delivery: %w", err))
 	}
 
 	if err := r.createPayment(ctx, tx, &order.Payment, order.OrderUID); err != nil {
-		return fmt.Errorf("failed to create payment: %w", err)
+		return classify(fmt.Errorf("failed to create payment: %w", err))
 	}
 
-	if err := r.createItems(ctx, tx, order.Items, order.OrderUID); err != nil {
-		return fmt.Errorf("failed to create items: %w", err)
+	if err := r.createItems(ctx, tx, order); err != nil {
+		return classify(fmt.Errorf("failed to create items: %w", err))
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return classify(fmt.Errorf("failed to commit transaction: %w", err))
 	}
 
 	return nil
 }
 
-func (r *OrderRepository) createOrder(ctx context.Context, tx pgx.Tx, order *models.Order) error {
-	query := `INSERT INTO orders (order_uid, track_number, entry, locale, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
-	_, err := tx.Exec(ctx, query, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.CustomerID,
-		order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard)
-	return err
+const (
+	insertOrderQuery = `INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, payload_hash)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+              ON CONFLICT (order_uid) DO NOTHING`
+	insertDeliveryQuery = `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	insertPaymentQuery = `INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	insertConflictQuery = `INSERT INTO order_conflicts (order_uid, existing_hash, payload_hash, payload) VALUES ($1, $2, $3, $4)`
+	selectOrdersQuery   = `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders`
+)
+
+var itemColumns = []string{"chrt_id", "order_uid", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"}
+
+func (r *OrderRepository) createOrder(ctx context.Context, tx pgx.Tx, order *models.Order, hash string) (_ bool, err error) {
+	ctx, span := startQuerySpan(ctx, "INSERT", "orders")
+	defer func() { endSpan(span, err) }()
+
+	tag, err := tx.Exec(ctx, insertOrderQuery, orderArgs(order, hash)...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// resolveDuplicate compares the incoming order with the stored one by payload hash.
+func (r *OrderRepository) resolveDuplicate(ctx context.Context, tx pgx.Tx, order *models.Order, payload []byte, hash string) error {
+	var existing *string
+	query := `SELECT payload_hash FROM orders WHERE order_uid = $1`
+	if err := tx.QueryRow(ctx, query, order.OrderUID).Scan(&existing); err != nil {
+		return classify(fmt.Errorf("failed to select payload hash by order_uid: %w", err))
+	}
+
+	if existing == nil {
+		hashes := map[string]*string{order.OrderUID: nil}
+		if err := r.legacyHashes(ctx, tx, hashes, map[string]*models.Order{order.OrderUID: order}); err != nil {
+			return classify(err)
+		}
+		existing = hashes[order.OrderUID]
+	}
+
+	if *existing == hash {
+		if err := tx.Commit(ctx); err != nil {
+			return classify(fmt.Errorf("failed to commit transaction: %w", err))
+		}
+		return fmt.Errorf("%w: %s", models.ErrOrderExists, order.OrderUID)
+	}
+
+	if _, err := tx.Exec(ctx, insertConflictQuery, order.OrderUID, *existing, hash, payload); err != nil {
+		return classify(fmt.Errorf("failed to record order conflict: %w", err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return classify(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+
+	return &models.OrderConflictError{OrderUID: order.OrderUID, ExistingHash: *existing, IncomingHash: hash}
+}
+
+// legacyHashes fills in the hashes of stored orders saved before payload hashes were
+// introduced, the nil entries of hashes. The original payload of such an order is unknown,
+// so the order is loaded and compared with the incoming one after normalizeLegacy. If they
+// match, the stored hash is backfilled with the hash of the incoming order, otherwise the
+// hash of the normalized stored order is reported as the existing one.
+func (r *OrderRepository) legacyHashes(ctx context.Context, tx pgx.Tx, hashes map[string]*string, incoming map[string]*models.Order) error {
+	var uids []string
+	for uid, hash := range hashes {
+		if hash == nil {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, selectOrdersQuery+` WHERE order_uid = ANY($1)`, uids)
+	if err != nil {
+		return classify(fmt.Errorf("failed to select orders without payload hash: %w", err))
+	}
+	stored, err := scanOrders(rows)
+	if err != nil {
+		return err
+	}
+	if err := r.loadDetails(ctx, tx, stored); err != nil {
+		return err
+	}
+
+	for _, order := range stored {
+		_, storedHash, err := orderPayload(normalizeLegacy(order))
+		if err != nil {
+			return fmt.Errorf("failed to encode stored order: %w", err)
+		}
+		_, incomingHash, err := orderPayload(normalizeLegacy(incoming[order.OrderUID]))
+		if err != nil {
+			return fmt.Errorf("failed to encode order: %w", err)
+		}
+
+		if storedHash != incomingHash {
+			hashes[order.OrderUID] = &storedHash
+			continue
+		}
+
+		_, hash, err := orderPayload(incoming[order.OrderUID])
+		if err != nil {
+			return fmt.Errorf("failed to encode order: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE orders SET payload_hash = $2 WHERE order_uid = $1`, order.OrderUID, hash); err != nil {
+			return classify(fmt.Errorf("failed to backfill payload hash: %w", err))
+		}
+		hashes[order.OrderUID] = &hash
+	}
+	return nil
+}
+
+// normalizeLegacy returns a copy of the order as it reads back from the DB: date_created
+// keeps the wall clock truncated to microseconds without the zone, and no items is nil.
+func normalizeLegacy(order *models.Order) *models.Order {
+	normalized := *order
+	t := order.DateCreated.Truncate(time.Microsecond)
+	normalized.DateCreated = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	if len(normalized.Items) == 0 {
+		normalized.Items = nil
+	}
+	return &normalized
+}
+
+// orderPayload returns the canonical JSON encoding of the order and its SHA-256 hash.
+func orderPayload(order *models.Order) ([]byte, string, error) {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(payload)
+	return payload, hex.EncodeToString(sum[:]), nil
 }
 
 func (r *OrderRepository) createDelivery(ctx context.Context, tx pgx.Tx, delivery *models.Delivery, orderUID string) error {
-	query := `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := tx.Exec(ctx, query, orderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
-		delivery.Address, delivery.Region, delivery.Email)
+	ctx, span := startQuerySpan(ctx, "INSERT", "delivery")
+	_, err := tx.Exec(ctx, insertDeliveryQuery, deliveryArgs(delivery, orderUID)...)
+	endSpan(span, err)
 	return err
 }
 
 func (r *OrderRepository) createPayment(ctx context.Context, tx pgx.Tx, payment *models.Payment, orderUID string) error {
-	query := `INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
-	_, err := tx.Exec(ctx, query, orderUID, payment.Transaction, payment.RequestID, payment.Currency, payment.Provider,
-		payment.Amount, payment.PaymentDt, payment.Bank, payment.DeliveryCost, payment.GoodsTotal, payment.CustomFee)
+	ctx, span := startQuerySpan(ctx, "INSERT", "payment")
+	_, err := tx.Exec(ctx, insertPaymentQuery, paymentArgs(payment, orderUID)...)
+	endSpan(span, err)
 	return err
 }
 
-func (r *OrderRepository) createItems(ctx context.Context, tx pgx.Tx, items []models.Item, orderUID string) error {
-	for _, item := range items {
-		query := `INSERT INTO item (chrt_id, order_uid, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
-                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
-		_, err := tx.Exec(ctx, query, item.ChrtID, orderUID, item.TrackNumber, item.Price, item.Rid, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
-		if err != nil {
-			return err
+// createItems inserts the items of all given orders with a single COPY.
+func (r *OrderRepository) createItems(ctx context.Context, tx pgx.Tx, orders ...*models.Order) error {
+	var rows [][]any
+	for _, order := range orders {
+		for _, item := range order.Items {
+			rows = append(rows, []any{item.ChrtID, order.OrderUID, item.TrackNumber, item.Price, item.Rid, item.Name,
+				item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status})
 		}
 	}
-	return nil
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	ctx, span := startQuerySpan(ctx, "COPY", "item")
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"item"}, itemColumns, pgx.CopyFromRows(rows))
+	endSpan(span, err)
+	return err
 }
 
-func (r *OrderRepository) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
-	var order models.Order
-	query := `SELECT order_uid, track_number, entry, locale, internal_signature,customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders WHERE order_uid = $1`
-	err := r.db.QueryRow(ctx, query, orderUID).Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard)
+func orderArgs(order *models.Order, hash string) []any {
+	return []any{order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID,
+		order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard, hash}
+}
+
+func deliveryArgs(delivery *models.Delivery, orderUID string) []any {
+	return []any{orderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
+		delivery.Address, delivery.Region, delivery.Email}
+}
+
+func paymentArgs(payment *models.Payment, orderUID string) []any {
+	return []any{orderUID, payment.Transaction, payment.RequestID, payment.Currency, payment.Provider,
+		payment.Amount, payment.PaymentDt, payment.Bank, payment.DeliveryCost, payment.GoodsTotal, payment.CustomFee}
+}
+
+// GetOrder loads the order with its delivery, payment and items, one query each. Every query
+// is traced as a child span of the method's span.
+func (r *OrderRepository) GetOrder(ctx context.Context, orderUID string) (_ *models.Order, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.GetOrder")
+	defer func() { endSpan(span, err) }()
+
+	order, err := r.getOrder(ctx, orderUID)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, models.ErrOrderNotFound
-		}
-		return nil, fmt.Errorf("failed to select order by order_uid: %w", err)
+		return nil, err
 	}
 
 	delivery, err := r.getDelivery(ctx, orderUID)
@@ -114,37 +285,62 @@ func (r *OrderRepository) GetOrder(ctx context.Context, orderUID string) (*model
 	}
 	order.Items = items
 
+	return order, nil
+}
+
+func (r *OrderRepository) getOrder(ctx context.Context, orderUID string) (_ *models.Order, err error) {
+	ctx, span := startQuerySpan(ctx, "SELECT", "orders")
+	defer func() { endSpan(span, err) }()
+
+	var order models.Order
+	query := `SELECT order_uid, track_number, entry, locale, internal_signature,customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders WHERE order_uid = $1`
+	err = r.db.QueryRow(ctx, query, orderUID).Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, models.ErrOrderNotFound
+		}
+		return nil, classify(fmt.Errorf("failed to select order by order_uid: %w", err))
+	}
 	return &order, nil
 }
 
-func (r *OrderRepository) getDelivery(ctx context.Context, orderUID string) (*models.Delivery, error) {
+func (r *OrderRepository) getDelivery(ctx context.Context, orderUID string) (_ *models.Delivery, err error) {
+	ctx, span := startQuerySpan(ctx, "SELECT", "delivery")
+	defer func() { endSpan(span, err) }()
+
 	var delivery models.Delivery
 	query := `SELECT name, phone, zip, city, address, region, email FROM delivery WHERE order_uid = $1`
-	err := r.db.QueryRow(ctx, query, orderUID).Scan(&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City,
+	err = r.db.QueryRow(ctx, query, orderUID).Scan(&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City,
 		&delivery.Address, &delivery.Region, &delivery.Email)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select delivery by order_uid: %w", err)
+		return nil, classify(fmt.Errorf("failed to select delivery by order_uid: %w", err))
 	}
 	return &delivery, nil
 }
 
-func (r *OrderRepository) getPayment(ctx context.Context, orderUID string) (*models.Payment, error) {
+func (r *OrderRepository) getPayment(ctx context.Context, orderUID string) (_ *models.Payment, err error) {
+	ctx, span := startQuerySpan(ctx, "SELECT", "payment")
+	defer func() { endSpan(span, err) }()
+
 	var p models.Payment
 	query := `SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee 
               FROM payment WHERE order_uid = $1`
-	err := r.db.QueryRow(ctx, query, orderUID).Scan(&p.Transaction, &p.RequestID, &p.Currency, &p.Provider,
+	err = r.db.QueryRow(ctx, query, orderUID).Scan(&p.Transaction, &p.RequestID, &p.Currency, &p.Provider,
 		&p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select payment by order_uid: %w", err)
+		return nil, classify(fmt.Errorf("failed to select payment by order_uid: %w", err))
 	}
 	return &p, nil
 }
 
-func (r *OrderRepository) getItems(ctx context.Context, orderUID string) ([]models.Item, error) {
-	query := `SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM item WHERE order_uid = $1`
+func (r *OrderRepository) getItems(ctx context.Context, orderUID string) (_ []models.Item, err error) {
+	ctx, span := startQuerySpan(ctx, "SELECT", "item")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM item WHERE order_uid = $1 ORDER BY id`
 	rows, err := r.db.Query(ctx, query, orderUID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select items by order_uid: %w", err)
+		return nil, classify(fmt.Errorf("failed to select items by order_uid: %w", err))
 	}
 	defer rows.Close()
 
@@ -154,27 +350,134 @@ func (r *OrderRepository) getItems(ctx context.Context, orderUID string) ([]mode
 		err := rows.Scan(&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
 			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan item: %w", err)
+			return nil, classify(fmt.Errorf("failed to scan item: %w", err))
 		}
 		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
+		return nil, classify(fmt.Errorf("rows iteration error: %w", err))
 	}
 
 	return items, nil
 }
 
-func (r *OrderRepository) GetOrders(ctx context.Context) ([]*models.Order, error) {
-	query := `SELECT order_uid, track_number, entry, locale, internal_signature,customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders`
+// StreamRecentOrders reads the limit most recent orders by date_created through a server-side
+// cursor and passes them to fn in chunks of chunkSize, from older to newer. Related rows are
+// loaded with one query per table for each chunk, so memory use is bounded by the chunk size.
+// The limit must not be negative and the chunk size must be positive.
+func (r *OrderRepository) StreamRecentOrders(ctx context.Context, limit, chunkSize int, fn func(orders []*models.Order) error) error {
+	if limit < 0 || chunkSize < 1 {
+		return fmt.Errorf("invalid limit %d or chunk size %d", limit, chunkSize)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return classify(fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := r.db.Query(ctx, query)
+	query := fmt.Sprintf(`DECLARE recent_orders NO SCROLL CURSOR FOR
+              SELECT order_uid, track_number, entry, locale, internal_signature,customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM (
+                  SELECT * FROM orders ORDER BY date_created DESC, order_uid DESC LIMIT %d
+              ) recent ORDER BY date_created, order_uid`, limit)
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return classify(fmt.Errorf("failed to declare cursor: %w", err))
+	}
 
+	fetch := fmt.Sprintf(`FETCH %d FROM recent_orders`, chunkSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return classify(fmt.Errorf("failed to fetch orders: %w", err))
+		}
+
+		orders, err := scanOrders(rows)
+		if err != nil {
+			return err
+		}
+
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err := r.loadDetails(ctx, tx, orders); err != nil {
+			return err
+		}
+
+		if err := fn(orders); err != nil {
+			return err
+		}
+	}
+}
+
+// ListOrders returns a page of orders matching the query, sorted by date_created and
+// order_uid. It loads up to query.Limit orders that come after query.After.
+func (r *OrderRepository) ListOrders(ctx context.Context, query models.OrdersQuery) ([]*models.Order, error) {
+	var conditions []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	f := query.Filter
+	if f.CustomerID != "" {
+		conditions = append(conditions, "customer_id = "+arg(f.CustomerID))
+	}
+	if f.DeliveryService != "" {
+		conditions = append(conditions, "delivery_service = "+arg(f.DeliveryService))
+	}
+	if f.Locale != "" {
+		conditions = append(conditions, "locale = "+arg(f.Locale))
+	}
+	if !f.CreatedFrom.IsZero() {
+		conditions = append(conditions, "date_created >= "+arg(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		conditions = append(conditions, "date_created <= "+arg(f.CreatedTo))
+	}
+	if f.Currency != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM payment p WHERE p.order_uid = orders.order_uid AND p.currency = "+arg(f.Currency)+")")
+	}
+
+	direction, comparison := "DESC", "<"
+	if query.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if query.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(date_created, order_uid) %s (%s, %s)", comparison, arg(query.After.DateCreated), arg(query.After.OrderUID)))
+	}
+
+	sql := selectOrdersQuery
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += fmt.Sprintf(" ORDER BY date_created %s, order_uid %s LIMIT %s", direction, direction, arg(query.Limit))
+
+	rows, err := r.db.Query(ctx, sql, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select orders: %w", err)
+		return nil, classify(fmt.Errorf("failed to select orders: %w", err))
+	}
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadDetails(ctx, r.db, orders); err != nil {
+		return nil, err
 	}
 
+	return orders, nil
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func scanOrders(rows pgx.Rows) ([]*models.Order, error) {
 	defer rows.Close()
 
 	var orders []*models.Order
@@ -183,33 +486,127 @@ func (r *OrderRepository) GetOrders(ctx context.Context) ([]*models.Order, error
 		err := rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard)
 
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return nil, classify(fmt.Errorf("failed to scan order: %w", err))
 		}
 
-		delivery, err := r.getDelivery(ctx, order.OrderUID)
-		if err != nil {
-			return nil, err
+		orders = append(orders, &order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classify(fmt.Errorf("rows iteration error: %w", err))
+	}
+
+	return orders, nil
+}
+
+// loadDetails fills delivery, payment and items of the orders using one query per table.
+func (r *OrderRepository) loadDetails(ctx context.Context, q querier, orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byUID := make(map[string]*models.Order, len(orders))
+	uids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		byUID[order.OrderUID] = order
+		uids = append(uids, order.OrderUID)
+	}
+
+	if err := r.loadDeliveries(ctx, q, uids, byUID); err != nil {
+		return err
+	}
+
+	if err := r.loadPayments(ctx, q, uids, byUID); err != nil {
+		return err
+	}
+
+	return r.loadItems(ctx, q, uids, byUID)
+}
+
+func (r *OrderRepository) loadDeliveries(ctx context.Context, q querier, uids []string, byUID map[string]*models.Order) error {
+	query := `SELECT order_uid, name, phone, zip, city, address, region, email FROM delivery WHERE order_uid = ANY($1)`
+	rows, err := q.Query(ctx, query, uids)
+	if err != nil {
+		return classify(fmt.Errorf("failed to select deliveries: %w", err))
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var uid string
+		var d models.Delivery
+		if err := rows.Scan(&uid, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+			return classify(fmt.Errorf("failed to scan delivery: %w", err))
 		}
-		order.Delivery = *delivery
+		byUID[uid].Delivery = d
+		found++
+	}
 
-		payment, err := r.getPayment(ctx, order.OrderUID)
-		if err != nil {
-			return nil, err
+	if err := rows.Err(); err != nil {
+		return classify(fmt.Errorf("rows iteration error: %w", err))
+	}
+
+	if found != len(uids) {
+		return fmt.Errorf("failed to select deliveries: found %d of %d", found, len(uids))
+	}
+	return nil
+}
+
+func (r *OrderRepository) loadPayments(ctx context.Context, q querier, uids []string, byUID map[string]*models.Order) error {
+	query := `SELECT order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+              FROM payment WHERE order_uid = ANY($1)`
+	rows, err := q.Query(ctx, query, uids)
+	if err != nil {
+		return classify(fmt.Errorf("failed to select payments: %w", err))
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var uid string
+		var p models.Payment
+		if err := rows.Scan(&uid, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider,
+			&p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee); err != nil {
+			return classify(fmt.Errorf("failed to scan payment: %w", err))
 		}
-		order.Payment = *payment
+		byUID[uid].Payment = p
+		found++
+	}
 
-		items, err := r.getItems(ctx, order.OrderUID)
+	if err := rows.Err(); err != nil {
+		return classify(fmt.Errorf("rows iteration error: %w", err))
+	}
+
+	if found != len(uids) {
+		return fmt.Errorf("failed to select payments: found %d of %d", found, len(uids))
+	}
+	return nil
+}
+
+func (r *OrderRepository) loadItems(ctx context.Context, q querier, uids []string, byUID map[string]*models.Order) error {
+	query := `SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+              FROM item WHERE order_uid = ANY($1) ORDER BY id`
+	rows, err := q.Query(ctx, query, uids)
+	if err != nil {
+		return classify(fmt.Errorf("failed to select items: %w", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uid string
+		var item models.Item
+		err := rows.Scan(&uid, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
 		if err != nil {
-			return nil, err
+			return classify(fmt.Errorf("failed to scan item: %w", err))
 		}
-		order.Items = items
-
-		orders = append(orders, &order)
+		order := byUID[uid]
+		order.Items = append(order.Items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
+		return classify(fmt.Errorf("rows iteration error: %w", err))
 	}
 
-	return orders, nil
+	return nil
 }
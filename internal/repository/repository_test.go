@@ -0,0 +1,250 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"webtechl0/internal/models"
+	"webtechl0/internal/repository"
+	"webtechl0/internal/testutil"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB connects to the database from TEST_DATABASE_URL and migrates a schema of its own,
+// dropped when the test ends. Tests that need a database are skipped without it.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse TEST_DATABASE_URL: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		pool.Close()
+	})
+
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	files, err := filepath.Glob("../../migrate/migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("failed to find migrations: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read migration: %v", err)
+		}
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		if _, err := pool.Exec(ctx, up); err != nil {
+			t.Fatalf("failed to apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return pool
+}
+
+func isConflict(err error) bool {
+	var conflict *models.OrderConflictError
+	return errors.As(err, &conflict)
+}
+
+func TestCreateOrderDuplicates(t *testing.T) {
+	pool := testDB(t)
+	repo := repository.NewOrderRepository(pool)
+	ctx := context.Background()
+
+	order := testutil.Order("b563")
+	if err := repo.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("failed to create a new order: %v", err)
+	}
+	if err := repo.CreateOrder(ctx, testutil.Order("b563")); !errors.Is(err, models.ErrOrderExists) {
+		t.Errorf("expected an identical order to exist, got %v", err)
+	}
+
+	changed := testutil.Order("b563")
+	changed.Payment.Amount++
+	if err := repo.CreateOrder(ctx, changed); !isConflict(err) {
+		t.Errorf("expected a changed order to conflict, got %v", err)
+	}
+
+	var conflicts int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM order_conflicts").Scan(&conflicts); err != nil || conflicts != 1 {
+		t.Errorf("expected one recorded conflict, got %d (%v)", conflicts, err)
+	}
+}
+
+func TestCreateOrderLegacyDuplicates(t *testing.T) {
+	pool := testDB(t)
+	repo := repository.NewOrderRepository(pool)
+	ctx := context.Background()
+
+	// date_created keeps neither the zone nor nanoseconds, so the stored orders read back
+	// differently from the ones sent.
+	identical := testutil.Order("identical")
+	identical.DateCreated = time.Date(2021, 11, 26, 9, 22, 19, 123456789, time.FixedZone("MSK", 3*60*60))
+	for _, order := range []*models.Order{identical, testutil.Order("changed")} {
+		if err := repo.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+	if _, err := pool.Exec(ctx, "UPDATE orders SET payload_hash = NULL"); err != nil {
+		t.Fatalf("failed to clear payload hashes: %v", err)
+	}
+
+	if err := repo.CreateOrder(ctx, identical); !errors.Is(err, models.ErrOrderExists) {
+		t.Errorf("expected an identical legacy order to exist, got %v", err)
+	}
+
+	var hash *string
+	if err := pool.QueryRow(ctx, "SELECT payload_hash FROM orders WHERE order_uid = 'identical'").Scan(&hash); err != nil || hash == nil {
+		t.Errorf("expected the payload hash to be backfilled, got %v (%v)", hash, err)
+	}
+
+	changed := testutil.Order("changed")
+	changed.Items[0].Price++
+	if err := repo.CreateOrder(ctx, changed); !isConflict(err) {
+		t.Errorf("expected a changed legacy order to conflict, got %v", err)
+	}
+}
+
+func TestCreateOrdersDuplicates(t *testing.T) {
+	pool := testDB(t)
+	repo := repository.NewOrderRepository(pool)
+	ctx := context.Background()
+
+	for _, uid := range []string{"identical", "changed"} {
+		if err := repo.CreateOrder(ctx, testutil.Order(uid)); err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	inBatchChanged := testutil.Order("new")
+	inBatchChanged.Delivery.City = "Haifa"
+	storedChanged := testutil.Order("changed")
+	storedChanged.Payment.Amount++
+
+	results, err := repo.CreateOrders(ctx, []*models.Order{
+		testutil.Order("new"),
+		testutil.Order("new"),
+		inBatchChanged,
+		testutil.Order("identical"),
+		storedChanged,
+	})
+	if err != nil {
+		t.Fatalf("failed to create orders: %v", err)
+	}
+
+	conflicts := []bool{false, false, true, false, true}
+	for i, conflict := range conflicts {
+		if conflict && !isConflict(results[i]) || !conflict && results[i] != nil {
+			t.Errorf("order %d: expected conflict %v, got %v", i, conflict, results[i])
+		}
+	}
+
+	order, err := repo.GetOrder(ctx, "new")
+	if err != nil {
+		t.Fatalf("failed to get order: %v", err)
+	}
+	if order.Delivery.City != testutil.Order("new").Delivery.City || len(order.Items) != 1 {
+		t.Errorf("expected the first copy of the order saved once, got %+v", order)
+	}
+
+	var recorded int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM order_conflicts").Scan(&recorded); err != nil || recorded != 2 {
+		t.Errorf("expected two recorded conflicts, got %d (%v)", recorded, err)
+	}
+}
+
+// TestStreamRecentOrdersInvalidLimit needs no database: the arguments are checked before
+// connecting, and nothing listens on the port.
+func TestStreamRecentOrdersInvalidLimit(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://postgres@127.0.0.1:1/orders?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer pool.Close()
+	repo := repository.NewOrderRepository(pool)
+
+	for _, args := range [][2]int{{-1, 100}, {100, 0}} {
+		err := repo.StreamRecentOrders(context.Background(), args[0], args[1], func(orders []*models.Order) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "invalid limit") {
+			t.Errorf("expected limit %d and chunk size %d to be rejected, got %v", args[0], args[1], err)
+		}
+	}
+}
+
+func TestBatchedLoadersMatchGetOrder(t *testing.T) {
+	pool := testDB(t)
+	repo := repository.NewOrderRepository(pool)
+	ctx := context.Background()
+
+	// Orders with no, one and several items, the newest last.
+	item := testutil.Order("").Items[0]
+	for i, uid := range []string{"no-items", "one-item", "three-items"} {
+		order := testutil.Order(uid)
+		order.DateCreated = order.DateCreated.Add(time.Duration(i) * time.Hour)
+		order.Items = nil
+		for j := range []int{0, 1, 3}[i] {
+			item.Rid = fmt.Sprintf("%s-%d", uid, j)
+			order.Items = append(order.Items, item)
+		}
+		if err := repo.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	listed, err := repo.ListOrders(ctx, models.OrdersQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to list orders: %v", err)
+	}
+	var streamed []*models.Order
+	err = repo.StreamRecentOrders(ctx, 10, 2, func(orders []*models.Order) error {
+		streamed = append(streamed, orders...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to stream orders: %v", err)
+	}
+
+	for name, orders := range map[string][]*models.Order{"ListOrders": listed, "StreamRecentOrders": streamed} {
+		if len(orders) != 3 {
+			t.Fatalf("%s: expected 3 orders, got %d", name, len(orders))
+		}
+		for _, order := range orders {
+			want, err := repo.GetOrder(ctx, order.OrderUID)
+			if err != nil {
+				t.Fatalf("failed to get order: %v", err)
+			}
+			if !reflect.DeepEqual(order, want) {
+				t.Errorf("%s: expected order %s as GetOrder returns it\n%+v\ngot\n%+v", name, order.OrderUID, want, order)
+			}
+		}
+	}
+	if n := len(listed[0].Items); listed[0].OrderUID != "three-items" || n != 3 {
+		t.Errorf("expected the newest order first with 3 items, got %s with %d", listed[0].OrderUID, n)
+	}
+}
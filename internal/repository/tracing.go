@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"webtechl0/internal/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "webtechl0/internal/repository"
+
+// startSpan starts the span of a repository method.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(semconv.DBSystemNamePostgreSQL))
+}
+
+// startQuerySpan starts the span of a single statement, named "<operation> <table>".
+func startQuerySpan(ctx context.Context, operation, table string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBCollectionName(table),
+		),
+	)
+}
+
+// endSpan records the error, if any, and ends the span. Missing, duplicate and conflicting
+// orders are expected outcomes, not failures.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, models.ErrOrderNotFound) && !errors.Is(err, models.ErrOrderConflict) && !errors.Is(err, models.ErrOrderExists) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"webtechl0/internal/models"
+	"webtechl0/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestGetOrderSpansOnError checks the span tree without a database: nothing listens on the
+// port, so the first query fails and the lookup stops there.
+func TestGetOrderSpansOnError(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	pool, err := pgxpool.New(context.Background(), "postgres://postgres@127.0.0.1:1/orders?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	_, err = repository.NewOrderRepository(pool).GetOrder(context.Background(), "b563")
+	if !errors.Is(err, models.ErrTransient) {
+		t.Fatalf("expected a transient error, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	query, method := spans[0], spans[1]
+
+	if method.Name != "OrderRepository.GetOrder" || method.Status.Code != codes.Error {
+		t.Errorf("expected a failed method span, got %q %+v", method.Name, method.Status)
+	}
+	if query.Name != "SELECT orders" || query.Parent.SpanID() != method.SpanContext.SpanID() || query.Status.Code != codes.Error {
+		t.Errorf("expected a failed query span under the method span, got %q %+v", query.Name, query.Status)
+	}
+}
@@ -2,77 +2,427 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"webtechl0/internal/cache"
+	"webtechl0/internal/metrics"
 	"webtechl0/internal/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 1000
 )
 
 type OrderRepository interface {
 	CreateOrder(ctx context.Context, order *models.Order) error
+	CreateOrders(ctx context.Context, orders []*models.Order) ([]error, error)
 	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
-	GetOrders(ctx context.Context) ([]*models.Order, error)
+	StreamRecentOrders(ctx context.Context, limit, chunkSize int, fn func(orders []*models.Order) error) error
+	ListOrders(ctx context.Context, query models.OrdersQuery) ([]*models.Order, error)
 }
 
 type OrderCache interface {
 	Get(orderUID string) (*models.Order, bool)
 	Put(orderUID string, order *models.Order)
+	Delete(orderUID string) bool
+	Len() int
+	Clear() int
+	Entries() []cache.EntryInfo[string]
+}
+
+// loadTimeout bounds a database load shared by concurrent GetOrder calls. The load does not
+// inherit the deadline of the caller that started it, since other callers may wait longer.
+const loadTimeout = 10 * time.Second
+
+const warmupChunkSize = 1000
+
+// CacheSnapshot saves the cache contents to a file and restores them from it.
+type CacheSnapshot interface {
+	SaveSnapshot(path string) error
+	LoadSnapshot(path string, maxAge time.Duration) (int, error)
+}
+
+// NegativeCache remembers order UIDs that were not found in the DB.
+type NegativeCache interface {
+	Get(orderUID string) (struct{}, bool)
+	Put(orderUID string, value struct{})
+	Delete(orderUID string) bool
+	Clear() int
 }
 
 type OrderService struct {
-	repo  OrderRepository
-	cache OrderCache
-	lg    *slog.Logger
+	repo         OrderRepository
+	cache        OrderCache
+	negative     NegativeCache
+	writeThrough bool
+	warmupLimit  int
+	warmup       warmupTracker
+	snapshot     CacheSnapshot
+	snapshotPath string
+	snapshotAge  time.Duration
+	loads        singleflight.Group
+	lg           *slog.Logger
+
+	// negativeMutex orders remembering a missing UID against creating orders, and creates
+	// counts created orders, so a lookup that raced with a creation never caches a miss.
+	negativeMutex sync.Mutex
+	creates       atomic.Uint64
 }
 
-func NewOrderService(repo OrderRepository, cache OrderCache, lg *slog.Logger) *OrderService {
-	return &OrderService{repo: repo, cache: cache, lg: lg}
+type Option func(*OrderService)
+
+// WithNegativeCache makes the service remember UIDs that are not in the DB, so repeated
+// lookups of unknown orders do not reach the DB until the entry expires or the order is created.
+func WithNegativeCache(negative NegativeCache) Option {
+	return func(s *OrderService) {
+		s.negative = negative
+	}
 }
 
+// WithWriteThrough controls whether created orders are put into the cache. It is enabled by default.
+func WithWriteThrough(enabled bool) Option {
+	return func(s *OrderService) {
+		s.writeThrough = enabled
+	}
+}
+
+// WithWarmupLimit sets how many of the most recent orders FillCache loads,
+// usually the capacity of the cache.
+func WithWarmupLimit(limit int) Option {
+	return func(s *OrderService) {
+		s.warmupLimit = limit
+	}
+}
+
+// WithSnapshot makes WarmUp restore the cache from the snapshot at path, if it is not older
+// than maxAge, and SaveSnapshot write it there. The snapshot is usually the cache itself.
+func WithSnapshot(snapshot CacheSnapshot, path string, maxAge time.Duration) Option {
+	return func(s *OrderService) {
+		s.snapshot = snapshot
+		s.snapshotPath = path
+		s.snapshotAge = maxAge
+	}
+}
+
+func NewOrderService(repo OrderRepository, cache OrderCache, lg *slog.Logger, opts ...Option) *OrderService {
+	s := &OrderService{repo: repo, cache: cache, writeThrough: true, lg: lg}
+	s.warmup.status.State = WarmupPending
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetOrder returns the order from the cache or loads it from the DB. Concurrent misses for
+// the same order share a single load. A caller that gives up stops waiting, but the load
+// goes on for the other callers and still populates the cache. Cache hits and misses are
+// recorded as events of the current span.
 func (s *OrderService) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	span := trace.SpanFromContext(ctx)
+	uidAttr := trace.WithAttributes(attribute.String("order_uid", orderUID))
+
 	if order, ok := s.cache.Get(orderUID); ok {
-		s.lg.Debug("Got order from cache", slog.Any("order_uid", orderUID))
+		span.AddEvent("cache.hit", uidAttr)
+		metrics.OrderLookups.WithLabelValues(metrics.SourceCache).Inc()
+		s.lg.DebugContext(ctx, "Got order from cache", slog.Any("order_uid", orderUID))
 		return order, nil
 	}
+	span.AddEvent("cache.miss", uidAttr)
 
-	order, err := s.repo.GetOrder(ctx, orderUID)
-	if err != nil {
-		return nil, err
+	if s.negative != nil {
+		if _, ok := s.negative.Get(orderUID); ok {
+			span.AddEvent("negative_cache.hit", uidAttr)
+			metrics.OrderLookups.WithLabelValues(metrics.SourceNegativeCache).Inc()
+			s.lg.DebugContext(ctx, "Order is known to be missing", slog.Any("order_uid", orderUID))
+			return nil, models.ErrOrderNotFound
+		}
 	}
 
-	s.lg.Debug("Got order from DB", slog.Any("order_uid", orderUID))
+	result := s.loads.DoChan(orderUID, func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
 
-	s.cache.Put(orderUID, order)
-	return order, nil
+		creates := s.creates.Load()
+		order, err := s.repo.GetOrder(loadCtx, orderUID)
+		if err != nil {
+			if errors.Is(err, models.ErrOrderNotFound) {
+				s.rememberMissing(orderUID, creates)
+			}
+			return nil, err
+		}
+
+		metrics.OrderLookups.WithLabelValues(metrics.SourceDB).Inc()
+		s.lg.DebugContext(ctx, "Got order from DB", slog.Any("order_uid", orderUID))
+
+		s.cache.Put(orderUID, order)
+		return order, nil
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*models.Order), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// rememberMissing adds the UID to the negative cache, unless an order was created since
+// the lookup started: it could be this very order, committed after the lookup had run.
+func (s *OrderService) rememberMissing(orderUID string, creates uint64) {
+	if s.negative == nil {
+		return
+	}
+
+	s.negativeMutex.Lock()
+	defer s.negativeMutex.Unlock()
+
+	if s.creates.Load() == creates {
+		s.negative.Put(orderUID, struct{}{})
+	}
+}
+
+// forgetMissing must be called after orders are committed, so that later lookups find them.
+func (s *OrderService) forgetMissing(orderUIDs ...string) {
+	if s.negative == nil {
+		return
+	}
+
+	s.negativeMutex.Lock()
+	defer s.negativeMutex.Unlock()
+
+	s.creates.Add(1)
+	for _, orderUID := range orderUIDs {
+		s.negative.Delete(orderUID)
+	}
 }
 
-func (s *OrderService) GetOrders(ctx context.Context) ([]*models.Order, error) {
-	orders, err := s.repo.GetOrders(ctx)
+// GetOrders returns a page of orders matching the query. NextCursor is set when more
+// orders are available.
+func (s *OrderService) GetOrders(ctx context.Context, query models.OrdersQuery) (*models.OrdersPage, error) {
+	if query.After != nil && query.After.Ascending != query.Ascending {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", models.ErrInvalidCursor)
+	}
+
+	limit := query.Limit
+	switch {
+	case limit <= 0:
+		limit = DefaultPageLimit
+	case limit > MaxPageLimit:
+		limit = MaxPageLimit
+	}
+	query.Limit = limit + 1
+
+	orders, err := s.repo.ListOrders(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	return orders, nil
+	page := &models.OrdersPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = models.OrderCursor{
+			DateCreated: last.DateCreated,
+			OrderUID:    last.OrderUID,
+			Ascending:   query.Ascending,
+		}.Encode()
+	}
+
+	if page.Orders == nil {
+		page.Orders = []*models.Order{}
+	}
+
+	return page, nil
 }
 
+// CreateOrder saves the order and, with write-through enabled, caches it. The order is
+// cached only once the repository reports the transaction as committed, so a failed
+// save never leaves an entry in the cache. An identical order that is already saved is
+// reported as models.ErrOrderExists.
 func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) error {
 	if err := s.repo.CreateOrder(ctx, order); err != nil {
+		if errors.Is(err, models.ErrOrderConflict) {
+			metrics.OrderConflicts.Inc()
+		}
+		return err
+	}
+
+	s.forgetMissing(order.OrderUID)
+	if s.writeThrough {
+		s.cache.Put(order.OrderUID, order)
+	}
+	return nil
+}
+
+// CreateOrders saves the orders in a single transaction, see OrderRepository.CreateOrders
+// for the meaning of the returned per-order errors.
+func (s *OrderService) CreateOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	results, err := s.repo.CreateOrders(ctx, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make([]string, 0, len(orders))
+	for i, err := range results {
+		if errors.Is(err, models.ErrOrderConflict) {
+			metrics.OrderConflicts.Inc()
+			continue
+		}
+		created = append(created, orders[i].OrderUID)
+	}
+	s.forgetMissing(created...)
+
+	if s.writeThrough {
+		for i, err := range results {
+			if err == nil {
+				s.cache.Put(orders[i].OrderUID, orders[i])
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// WarmUp restores the cache from the snapshot set with WithSnapshot. When there is no
+// snapshot or it is missing, stale or corrupt, it falls back to FillCache.
+func (s *OrderService) WarmUp(ctx context.Context) error {
+	if s.snapshot == nil {
+		return s.FillCache(ctx)
+	}
+
+	lg := s.lg.With(slog.String("op", "OrderService.WarmUp"), slog.String("path", s.snapshotPath))
+
+	if err := s.warmup.start(WarmupFromSnapshot, s.warmupLimit); err != nil {
 		return err
 	}
+	start := time.Now()
 
+	loaded, err := s.snapshot.LoadSnapshot(s.snapshotPath, s.snapshotAge)
+	if err != nil {
+		lg.WarnContext(ctx, "Failed to restore cache from snapshot, loading from DB", slog.Any("error", err))
+		s.warmup.fallback(WarmupFromDB)
+		return s.fillCache(ctx)
+	}
+
+	s.warmup.progress(loaded)
+	s.warmup.finish(nil)
+	lg.InfoContext(ctx, "Cache restored from snapshot", slog.Int("loaded", loaded), slog.Duration("duration", time.Since(start)))
 	return nil
 }
 
+// SaveSnapshot writes the cache to the snapshot set with WithSnapshot. It does nothing
+// without a snapshot.
+func (s *OrderService) SaveSnapshot() error {
+	if s.snapshot == nil {
+		return nil
+	}
+
+	start := time.Now()
+	if err := s.snapshot.SaveSnapshot(s.snapshotPath); err != nil {
+		return fmt.Errorf("failed to save cache snapshot: %w", err)
+	}
+
+	s.lg.Info("Cache snapshot saved",
+		slog.String("op", "OrderService.SaveSnapshot"),
+		slog.String("path", s.snapshotPath),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
+
+// FillCache loads the most recent orders into the cache, at most the warm-up limit set with
+// WithWarmupLimit. Orders are streamed from the DB in chunks, the newest end up as the most
+// recently used. Progress is logged and reported by WarmupStatus. It returns
+// models.ErrWarmupInProgress if another warm-up is running.
 func (s *OrderService) FillCache(ctx context.Context) error {
-	orders, err := s.repo.GetOrders(ctx)
+	if err := s.warmup.start(WarmupFromDB, s.warmupLimit); err != nil {
+		return err
+	}
+	return s.fillCache(ctx)
+}
+
+// RewarmCache empties the cache and fills it again from the DB in the background, it returns
+// once the warm-up has started. The warm-up runs until it is done or ctx is cancelled.
+func (s *OrderService) RewarmCache(ctx context.Context) error {
+	if err := s.warmup.start(WarmupFromDB, s.warmupLimit); err != nil {
+		return err
+	}
+
+	purged := s.cache.Clear()
+	s.lg.InfoContext(ctx, "Cache purged for re-warm", slog.String("op", "OrderService.RewarmCache"), slog.Int("purged", purged))
+
+	go func() {
+		if err := s.fillCache(ctx); err != nil {
+			s.lg.ErrorContext(ctx, "Failed to re-warm cache", slog.String("op", "OrderService.RewarmCache"), slog.Any("error", err))
+		}
+	}()
+	return nil
+}
 
+func (s *OrderService) fillCache(ctx context.Context) error {
+	lg := s.lg.With(slog.String("op", "OrderService.FillCache"), slog.Int("limit", s.warmupLimit))
+
+	start := time.Now()
+	lg.InfoContext(ctx, "Warming up cache")
+
+	loaded := 0
+	err := s.repo.StreamRecentOrders(ctx, s.warmupLimit, warmupChunkSize, func(orders []*models.Order) error {
+		for _, order := range orders {
+			s.cache.Put(order.OrderUID, order)
+		}
+
+		loaded += len(orders)
+		s.warmup.progress(loaded)
+		lg.InfoContext(ctx, "Cache warm-up progress", slog.Int("loaded", loaded))
+		return nil
+	})
+
+	s.warmup.finish(err)
 	if err != nil {
 		return fmt.Errorf("failed to load orders from DB: %w", err)
 	}
 
-	for _, order := range orders {
-		s.cache.Put(order.OrderUID, order)
+	lg.InfoContext(ctx, "Cache warm-up finished", slog.Int("loaded", loaded), slog.Duration("duration", time.Since(start)))
+	return nil
+}
 
+func (s *OrderService) WarmupStatus() WarmupStatus {
+	return s.warmup.get()
+}
+
+// InvalidateOrder removes the order from the cache, so the next lookup loads it from the DB.
+// It also forgets that the order was missing. It reports whether the order was cached.
+func (s *OrderService) InvalidateOrder(orderUID string) bool {
+	s.forgetMissing(orderUID)
+	return s.cache.Delete(orderUID)
+}
+
+// PurgeCache removes all orders from the cache, and all remembered misses, and returns how
+// many orders were removed.
+func (s *OrderService) PurgeCache() int {
+	if s.negative != nil {
+		s.negativeMutex.Lock()
+		s.creates.Add(1)
+		s.negative.Clear()
+		s.negativeMutex.Unlock()
 	}
+	return s.cache.Clear()
+}
 
-	return nil
+// CachedOrders lists the cached orders from the last to the first candidate for eviction,
+// for LRU from the most recently used.
+func (s *OrderService) CachedOrders() []cache.EntryInfo[string] {
+	return s.cache.Entries()
 }
@@ -0,0 +1,356 @@
+package service_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"webtechl0/internal/cache"
+	"webtechl0/internal/models"
+	"webtechl0/internal/service"
+)
+
+type fakeRepository struct {
+	service.OrderRepository
+
+	mu        sync.Mutex
+	orders    map[string]*models.Order
+	loads     atomic.Int32
+	release   chan struct{}
+	createErr error
+	listLimit int
+	// streamed, if set, is closed by the test to let StreamRecentOrders finish.
+	streamed chan struct{}
+}
+
+func newFakeRepository(orders ...*models.Order) *fakeRepository {
+	r := &fakeRepository{orders: make(map[string]*models.Order)}
+	for _, order := range orders {
+		r.orders[order.OrderUID] = order
+	}
+	return r
+}
+
+func (r *fakeRepository) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	r.loads.Add(1)
+	if r.release != nil {
+		select {
+		case <-r.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[orderUID]
+	if !ok {
+		return nil, models.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (r *fakeRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[order.OrderUID] = order
+	return nil
+}
+
+// ListOrders returns the orders newest first, or oldest first if query.Ascending, ignoring
+// the filter. It records the limit it was asked for.
+func (r *fakeRepository) ListOrders(ctx context.Context, query models.OrdersQuery) ([]*models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listLimit = query.Limit
+
+	orders := slices.SortedFunc(maps.Values(r.orders), func(a, b *models.Order) int {
+		c := cmp.Or(a.DateCreated.Compare(b.DateCreated), strings.Compare(a.OrderUID, b.OrderUID))
+		if !query.Ascending {
+			c = -c
+		}
+		return c
+	})
+
+	if after := query.After; after != nil {
+		orders = slices.DeleteFunc(orders, func(order *models.Order) bool {
+			c := cmp.Or(order.DateCreated.Compare(after.DateCreated), strings.Compare(order.OrderUID, after.OrderUID))
+			return c == 0 || c < 0 == query.Ascending
+		})
+	}
+	return orders[:min(len(orders), query.Limit)], nil
+}
+
+func (r *fakeRepository) StreamRecentOrders(ctx context.Context, limit, chunkSize int, fn func(orders []*models.Order) error) error {
+	if r.streamed != nil {
+		select {
+		case <-r.streamed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	orders := slices.Collect(maps.Values(r.orders))
+	r.mu.Unlock()
+	return fn(orders)
+}
+
+func newTestService(repo service.OrderRepository, opts ...service.Option) *service.OrderService {
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return service.NewOrderService(repo, cache.NewLRUCache[string, *models.Order](10), lg, opts...)
+}
+
+func TestGetOrderCoalescesLoads(t *testing.T) {
+	repo := newFakeRepository(&models.Order{OrderUID: "a"})
+	repo.release = make(chan struct{})
+	s := newTestService(repo)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+
+	// The first caller gives up, which must not affect the others.
+	cancelled, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := s.GetOrder(cancelled, "a"); !errors.Is(err, context.Canceled) {
+			errs <- err
+		}
+	}()
+
+	for range callers - 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order, err := s.GetOrder(context.Background(), "a")
+			if err != nil || order.OrderUID != "a" {
+				errs <- err
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	if n := repo.loads.Load(); n != 1 {
+		t.Errorf("expected 1 load, got %d", n)
+	}
+
+	if _, err := s.GetOrder(context.Background(), "a"); err != nil || repo.loads.Load() != 1 {
+		t.Errorf("expected order to be served from cache")
+	}
+}
+
+func TestGetOrderNegativeCache(t *testing.T) {
+	repo := newFakeRepository()
+	negative := cache.NewLRUCache(10, cache.WithTTL[string, struct{}](time.Minute))
+	s := newTestService(repo, service.WithNegativeCache(negative))
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := s.GetOrder(ctx, "a"); !errors.Is(err, models.ErrOrderNotFound) {
+			t.Fatalf("expected ErrOrderNotFound, got %v", err)
+		}
+	}
+
+	if n := repo.loads.Load(); n != 1 {
+		t.Errorf("expected 1 load for repeated misses, got %d", n)
+	}
+
+	if err := s.CreateOrder(ctx, &models.Order{OrderUID: "a"}); err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	if order, err := s.GetOrder(ctx, "a"); err != nil || order.OrderUID != "a" {
+		t.Errorf("expected created order to be found, got %v", err)
+	}
+}
+
+func TestCreateOrderWriteThrough(t *testing.T) {
+	repo := newFakeRepository()
+	s := newTestService(repo)
+	ctx := context.Background()
+
+	if err := s.CreateOrder(ctx, &models.Order{OrderUID: "a"}); err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	if _, err := s.GetOrder(ctx, "a"); err != nil || repo.loads.Load() != 0 {
+		t.Errorf("expected created order to be served from cache, loads %d, error %v", repo.loads.Load(), err)
+	}
+
+	repo.createErr = errors.New("commit failed")
+	if err := s.CreateOrder(ctx, &models.Order{OrderUID: "b"}); err == nil {
+		t.Fatalf("expected create to fail")
+	}
+
+	if _, err := s.GetOrder(ctx, "b"); !errors.Is(err, models.ErrOrderNotFound) {
+		t.Errorf("expected failed order not to be cached, got %v", err)
+	}
+}
+
+func TestGetOrdersPages(t *testing.T) {
+	start := time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)
+	var orders []*models.Order
+	for i := range 5 {
+		orders = append(orders, &models.Order{OrderUID: string(rune('a' + i)), DateCreated: start.Add(time.Duration(i/2) * time.Hour)})
+	}
+	repo := newFakeRepository(orders...)
+	s := newTestService(repo)
+	ctx := context.Background()
+
+	var uids []string
+	query := models.OrdersQuery{Limit: 2, Ascending: true}
+	for pages := 1; ; pages++ {
+		page, err := s.GetOrders(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to get orders: %v", err)
+		}
+		if repo.listLimit != 3 {
+			t.Errorf("expected one order more than the limit to be loaded, got %d", repo.listLimit)
+		}
+		for _, order := range page.Orders {
+			uids = append(uids, order.OrderUID)
+		}
+
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		if len(page.Orders) != 2 {
+			t.Fatalf("expected a full page before the last one, got %d orders", len(page.Orders))
+		}
+		if query.After, err = models.DecodeOrderCursor(page.NextCursor); err != nil {
+			t.Fatalf("failed to decode next_cursor: %v", err)
+		}
+	}
+
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(uids, want) {
+		t.Errorf("expected every order once in order %v, got %v", want, uids)
+	}
+
+	// A page that is exactly full has no next page.
+	if page, err := s.GetOrders(ctx, models.OrdersQuery{Limit: 5}); err != nil || len(page.Orders) != 5 || page.NextCursor != "" {
+		t.Errorf("expected all orders without next_cursor, got %+v %v", page, err)
+	}
+
+	if _, err := s.GetOrders(ctx, models.OrdersQuery{Limit: 2, After: query.After}); !errors.Is(err, models.ErrInvalidCursor) {
+		t.Errorf("expected a cursor of the other sort order to be rejected, got %v", err)
+	}
+}
+
+func TestWarmupStatus(t *testing.T) {
+	repo := newFakeRepository(&models.Order{OrderUID: "a"})
+	repo.streamed = make(chan struct{})
+	s := newTestService(repo)
+	ctx := context.Background()
+
+	if status := s.WarmupStatus(); status.Warmed || status.State != service.WarmupPending {
+		t.Errorf("expected not warmed before the warm-up, got %+v", status)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.FillCache(ctx) }()
+	waitWarmup(t, s, service.WarmupRunning)
+	if status := s.WarmupStatus(); status.Warmed {
+		t.Errorf("expected not warmed during the first warm-up, got %+v", status)
+	}
+
+	close(repo.streamed)
+	if err := <-done; err != nil {
+		t.Fatalf("failed to fill cache: %v", err)
+	}
+	if status := s.WarmupStatus(); !status.Warmed || status.State != service.WarmupDone || status.Loaded != 1 {
+		t.Errorf("expected warmed with 1 order, got %+v", status)
+	}
+
+	// A re-warm keeps the service ready while it runs.
+	repo.streamed = make(chan struct{})
+	if err := s.RewarmCache(ctx); err != nil {
+		t.Fatalf("failed to re-warm cache: %v", err)
+	}
+	if status := s.WarmupStatus(); !status.Warmed || status.State != service.WarmupRunning {
+		t.Errorf("expected still warmed during a re-warm, got %+v", status)
+	}
+	close(repo.streamed)
+	waitWarmup(t, s, service.WarmupDone)
+}
+
+func waitWarmup(t *testing.T, s *service.OrderService, state service.WarmupState) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.WarmupStatus().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected warm-up to be %s, got %+v", state, s.WarmupStatus())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOrderWeigher(t *testing.T) {
+	order := &models.Order{OrderUID: "a", Items: []models.Item{{Name: "item"}}}
+	small := service.OrderWeigher(order.OrderUID, order)
+
+	for range 10 {
+		order.Items = append(order.Items, models.Item{Name: "item", Brand: "brand"})
+	}
+	if large := service.OrderWeigher(order.OrderUID, order); large <= small {
+		t.Errorf("expected more items to weigh more, got %d and %d", small, large)
+	}
+}
+
+func TestInvalidateOrder(t *testing.T) {
+	repo := newFakeRepository(&models.Order{OrderUID: "a", TrackNumber: "old"})
+	negative := cache.NewLRUCache(10, cache.WithTTL[string, struct{}](time.Minute))
+	s := newTestService(repo, service.WithNegativeCache(negative))
+	ctx := context.Background()
+
+	if _, err := s.GetOrder(ctx, "a"); err != nil {
+		t.Fatalf("failed to get order: %v", err)
+	}
+	if _, err := s.GetOrder(ctx, "b"); !errors.Is(err, models.ErrOrderNotFound) {
+		t.Fatalf("expected ErrOrderNotFound, got %v", err)
+	}
+
+	repo.mu.Lock()
+	repo.orders["a"] = &models.Order{OrderUID: "a", TrackNumber: "fixed"}
+	repo.orders["b"] = &models.Order{OrderUID: "b"}
+	repo.mu.Unlock()
+
+	if !s.InvalidateOrder("a") || s.InvalidateOrder("b") {
+		t.Errorf("expected only order a to be cached")
+	}
+
+	if order, err := s.GetOrder(ctx, "a"); err != nil || order.TrackNumber != "fixed" {
+		t.Errorf("expected fixed order after invalidation, got %v, error %v", order, err)
+	}
+	if _, err := s.GetOrder(ctx, "b"); err != nil {
+		t.Errorf("expected order b to be found after invalidation, got %v", err)
+	}
+}
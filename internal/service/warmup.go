@@ -0,0 +1,95 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"webtechl0/internal/models"
+)
+
+type WarmupState string
+
+const (
+	WarmupPending WarmupState = "pending"
+	WarmupRunning WarmupState = "running"
+	WarmupDone    WarmupState = "done"
+	WarmupFailed  WarmupState = "failed"
+)
+
+// Warm-up sources.
+const (
+	WarmupFromSnapshot = "snapshot"
+	WarmupFromDB       = "db"
+)
+
+type WarmupStatus struct {
+	State      WarmupState `json:"state"`
+	Source     string      `json:"source,omitempty"`
+	Loaded     int         `json:"loaded"`
+	Limit      int         `json:"limit"`
+	StartedAt  time.Time   `json:"started_at,omitzero"`
+	FinishedAt time.Time   `json:"finished_at,omitzero"`
+	Error      string      `json:"error,omitempty"`
+	// Warmed is set once the first warm-up has finished and stays set during later ones.
+	Warmed bool `json:"warmed"`
+}
+
+// Finished reports whether the warm-up is over, successfully or not.
+func (s WarmupStatus) Finished() bool {
+	return s.State == WarmupDone || s.State == WarmupFailed
+}
+
+type warmupTracker struct {
+	mutex  sync.Mutex
+	status WarmupStatus
+}
+
+func (t *warmupTracker) get() WarmupStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.status
+}
+
+// start returns models.ErrWarmupInProgress if another warm-up is running.
+func (t *warmupTracker) start(source string, limit int) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.status.State == WarmupRunning {
+		return models.ErrWarmupInProgress
+	}
+	t.status = WarmupStatus{
+		State:     WarmupRunning,
+		Source:    source,
+		Limit:     limit,
+		StartedAt: time.Now(),
+		Warmed:    t.status.Warmed,
+	}
+	return nil
+}
+
+// fallback switches a running warm-up to another source.
+func (t *warmupTracker) fallback(source string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status.Source = source
+	t.status.Loaded = 0
+}
+
+func (t *warmupTracker) progress(loaded int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status.Loaded = loaded
+}
+
+func (t *warmupTracker) finish(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status.FinishedAt = time.Now()
+	t.status.Warmed = true
+	if err != nil {
+		t.status.State = WarmupFailed
+		t.status.Error = err.Error()
+		return
+	}
+	t.status.State = WarmupDone
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"unsafe"
+
+	"webtechl0/internal/models"
+)
+
+// cacheEntryOverhead approximates the memory a cache takes per entry besides the order
+// itself: the key, the map bucket and the list node.
+const cacheEntryOverhead = 128
+
+// OrderWeigher estimates the memory used by a cached order in bytes from its fields and
+// items. It is meant for cache.WithMaxWeight.
+func OrderWeigher(orderUID string, order *models.Order) int64 {
+	size := cacheEntryOverhead + len(orderUID) + int(unsafe.Sizeof(*order))
+	size += len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) + len(order.Locale) +
+		len(order.CustomerID) + len(order.DeliveryService) + len(order.ShardKey) + len(order.OofShard)
+	if order.InternalSignature != nil {
+		size += len(*order.InternalSignature)
+	}
+
+	d := &order.Delivery
+	size += len(d.OrderUID) + len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) +
+		len(d.Address) + len(d.Region) + len(d.Email)
+
+	p := &order.Payment
+	size += len(p.OrderUID) + len(p.Transaction) + len(p.Currency) + len(p.Provider) + len(p.Bank)
+	if p.RequestID != nil {
+		size += len(*p.RequestID)
+	}
+
+	size += cap(order.Items) * int(unsafe.Sizeof(models.Item{}))
+	for i := range order.Items {
+		item := &order.Items[i]
+		size += len(item.OrderUID) + len(item.TrackNumber) + len(item.Rid) + len(item.Name) +
+			len(item.Size) + len(item.Brand)
+	}
+
+	return int64(size)
+}
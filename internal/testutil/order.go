@@ -0,0 +1,36 @@
+// Package testutil holds fixtures shared by the tests of several packages.
+package testutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"webtechl0/internal/models"
+)
+
+// Order returns a valid order with the given order_uid, identical on every call.
+func Order(uid string) *models.Order {
+	return &models.Order{
+		OrderUID: uid, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL", Locale: "en", CustomerID: "test",
+		DeliveryService: "meest", ShardKey: "9", SmID: 99, OofShard: "1",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery: models.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: models.Payment{Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+		Items: []models.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+	}
+}
+
+// OrderJSON returns Order encoded as a message or request body.
+func OrderJSON(t testing.TB, uid string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(Order(uid))
+	if err != nil {
+		t.Fatalf("failed to encode order: %v", err)
+	}
+	return data
+}
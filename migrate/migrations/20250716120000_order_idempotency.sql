@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payload_hash VARCHAR;
+
+CREATE TABLE IF NOT EXISTS order_conflicts (
+    id SERIAL PRIMARY KEY,
+    order_uid VARCHAR NOT NULL,
+    existing_hash VARCHAR,
+    payload_hash VARCHAR NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_conflicts_order_uid ON order_conflicts(order_uid);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_conflicts;
+ALTER TABLE orders DROP COLUMN IF EXISTS payload_hash;
+-- +goose StatementEnd